@@ -18,6 +18,8 @@ import (
 	"github.com/suPer8Hu/ai-platform/internal/chat"
 	"github.com/suPer8Hu/ai-platform/internal/config"
 	"github.com/suPer8Hu/ai-platform/internal/db"
+	"github.com/suPer8Hu/ai-platform/internal/providers"
+	"github.com/suPer8Hu/ai-platform/internal/store/blobstore"
 )
 
 const (
@@ -154,35 +156,33 @@ func main() {
 	// }
 
 	// Provider registry (route by session.Provider + session.Model)
-	reg := ai.NewRegistry()
-
-	// Register Ollama (default)
-	reg.Register("ollama", func(ctx context.Context, model string) (ai.Provider, error) {
-		_ = ctx
-		m := strings.TrimSpace(model)
-		if m == "" {
-			m = cfg.OllamaModel
-		}
-		return ai.NewOllamaProvider(cfg.OllamaBaseURL, m), nil
-	})
+	providerSet, err := providers.New(cfg)
+	if err != nil {
+		log.Fatalf("providers: %v", err)
+	}
+	reg := providerSet.Registry
 
-	// Register OpenRouter (OpenAI-compatible)
-	reg.Register("openrouter", func(ctx context.Context, model string) (ai.Provider, error) {
-		_ = ctx
-		m := strings.TrimSpace(model)
-		if m == "" {
-			m = cfg.OpenRouterModel
+	svc := chat.NewService(repo, reg, cfg.ChatContextWindowSize)
+	svc.SetTokenBudget(cfg.AIContextTokens, cfg.AIReplyReserveTokens)
+	catalog := ai.NewCatalog(reg, cfg.AIModelsCacheTTL)
+	providerSet.OnReload(func(changed []string) {
+		for _, name := range changed {
+			catalog.Invalidate(name)
 		}
-		return ai.NewOpenRouterProvider(
-			cfg.OpenRouterBaseURL,
-			cfg.OpenRouterAPIKey,
-			m,
-			cfg.OpenRouterSiteURL,
-			cfg.OpenRouterAppName,
-		), nil
 	})
-
-	svc := chat.NewService(repo, reg, cfg.ChatContextWindowSize)
+	svc.SetCatalog(catalog)
+	fallbacks, err := ai.ParseBackends(cfg.AIFallbackChain)
+	if err != nil {
+		log.Fatalf("AI_FALLBACK_CHAIN: %v", err)
+	}
+	svc.SetFallbackChain(fallbacks)
+	if cfg.BlobDir != "" {
+		blobs, err := blobstore.NewLocal(cfg.BlobDir)
+		if err != nil {
+			log.Fatalf("blob store: %v", err)
+		}
+		svc.SetBlobStore(blobs)
+	}
 
 	conn, err := amqp.Dial(cfg.RabbitURL)
 	if err != nil {
@@ -241,6 +241,7 @@ func main() {
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
+	go providerSet.Watch(ctx)
 
 	log.Printf("worker started, queue=%s concurrency=%d max_retries=%d", mainQ, concurrency, maxR)
 
@@ -282,7 +283,7 @@ func main() {
 					log.Printf("worker=%d job=%s failed cost=%s retry=%d err=%v", workerID, m.JobID, cost, retryCount, err)
 
 					// Decide retry vs DLQ
-					if retryCount < maxR {
+					if retryCount < maxR && retryable(err) {
 						// Publish to retry queue with incremented retry count and delay.
 						h := amqp.Table{}
 						for k, v := range d.Headers {
@@ -383,7 +384,7 @@ func handleJob(ctx context.Context, svc *chat.Service, repo *chat.Repo, jobID st
 	}
 
 	t2 := time.Now()
-	reply, assistantMsgID, err := svc.GenerateAssistantReplyAndInsert(ctx, j.UserID, j.SessionID)
+	reply, assistantMsgID, err := svc.GenerateAssistantReplyAndInsert(ctx, j.UserID, j.SessionID, j.Options, j.ResponseFormat)
 	genCost := time.Since(t2)
 
 	if err != nil {
@@ -416,9 +417,26 @@ func handleJob(ctx context.Context, svc *chat.Service, repo *chat.Repo, jobID st
 		)
 	}
 
+	// fold turns that fell out of the context window into the session summary;
+	// the reply is already delivered, so a failure here only gets logged
+	if _, err := svc.UpdateSummary(ctx, j.UserID, j.SessionID); err != nil {
+		log.Printf("summary job=%s session=%s err=%v", jobID, j.SessionID, err)
+	}
+
 	return nil
 }
 
+// retryable reports whether a failed job may succeed later. Errors the
+// provider will keep returning (bad credentials, unknown model, oversized
+// context, filtered content) go straight to the DLQ.
+func retryable(err error) bool {
+	switch ai.ErrorKind(err) {
+	case ai.ErrAuthFailed, ai.ErrModelNotFound, ai.ErrContextTooLong, ai.ErrContentFiltered:
+		return false
+	}
+	return true
+}
+
 // truncateErr keeps headers small
 func truncateErr(err error) string {
 	if err == nil {
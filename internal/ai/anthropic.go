@@ -0,0 +1,417 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"iter"
+	"net/http"
+	"strings"
+)
+
+const anthropicVersion = "2023-06-01"
+
+type AnthropicProvider struct {
+	BaseURL string
+	APIKey  string
+	Model   string
+	// MaxTokens is required by the Messages API.
+	MaxTokens int
+	Client    *http.Client
+}
+
+type anthropicMsg struct {
+	Role string `json:"role"`
+	// Content is either a plain string or a list of anthropicBlock.
+	Content any `json:"content"`
+}
+
+type anthropicBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+	// tool_result
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+	// image
+	Source *anthropicImageSource `json:"source,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"` // "base64"
+	MediaType string `json:"media_type"`
+	Data      []byte `json:"data"` // base64 on the wire
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicChatReq struct {
+	Model         string          `json:"model"`
+	System        string          `json:"system,omitempty"`
+	Messages      []anthropicMsg  `json:"messages"`
+	Tools         []anthropicTool `json:"tools,omitempty"`
+	MaxTokens     int             `json:"max_tokens"`
+	Stream        bool            `json:"stream"`
+	Temperature   *float64        `json:"temperature,omitempty"`
+	TopP          *float64        `json:"top_p,omitempty"`
+	StopSequences []string        `json:"stop_sequences,omitempty"`
+}
+
+type anthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// anthropicErrorStatus maps the error types that can arrive inside a 200
+// stream to the status the API would have used.
+func anthropicErrorStatus(e *anthropicError) int {
+	if e == nil {
+		return 0
+	}
+	switch e.Type {
+	case "overloaded_error":
+		return 529
+	case "rate_limit_error":
+		return http.StatusTooManyRequests
+	case "api_error":
+		return http.StatusInternalServerError
+	}
+	return 0
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type anthropicChatResp struct {
+	Content []anthropicBlock `json:"content"`
+	Usage   anthropicUsage   `json:"usage"`
+	Error   *anthropicError  `json:"error,omitempty"`
+}
+
+// anthropicStreamEvent covers the SSE payloads we care about; the event name
+// is repeated in the "type" field so the `event:` lines can be ignored.
+type anthropicStreamEvent struct {
+	Type  string `json:"type"`
+	Delta struct {
+		Type     string `json:"type"`
+		Text     string `json:"text"`
+		Thinking string `json:"thinking"`
+		// on message_delta
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	// message_start carries the input token count, message_delta the output count
+	Message struct {
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	Usage anthropicUsage  `json:"usage"`
+	Error *anthropicError `json:"error,omitempty"`
+}
+
+func NewAnthropicProvider(baseURL, apiKey, model string, maxTokens int) *AnthropicProvider {
+	if baseURL == "" {
+		baseURL = "https://api.anthropic.com"
+	}
+	if maxTokens <= 0 {
+		maxTokens = 4096
+	}
+	return &AnthropicProvider{
+		BaseURL:   baseURL,
+		APIKey:    apiKey,
+		Model:     model,
+		MaxTokens: maxTokens,
+		Client:    newHTTPClient(baseURL),
+	}
+}
+
+func (p *AnthropicProvider) backendKey() string { return "anthropic" + "|" + p.BaseURL }
+
+func (p *AnthropicProvider) httpClient() *http.Client { return p.Client }
+
+// buildRequest lifts system messages out of the conversation into the
+// top-level `system` field, which is where the Messages API expects them.
+// Tool calls and results become tool_use / tool_result content blocks.
+func (p *AnthropicProvider) buildRequest(in ChatRequest, stream bool) (anthropicChatReq, error) {
+	if p.Client == nil {
+		return anthropicChatReq{}, errors.New("anthropic: http client is nil")
+	}
+	if strings.TrimSpace(p.APIKey) == "" {
+		return anthropicChatReq{}, errors.New("anthropic: api key is required")
+	}
+	model := strings.TrimSpace(p.Model)
+	if model == "" {
+		return anthropicChatReq{}, errors.New("anthropic: model is required")
+	}
+
+	var system []string
+	msgs := make([]anthropicMsg, 0, len(in.Messages))
+	for _, m := range in.Messages {
+		switch {
+		case m.Role == "system":
+			system = append(system, m.Content)
+		case m.Role == "tool":
+			block := anthropicBlock{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.Content}
+			// consecutive results answer the same assistant turn and share one user message
+			if n := len(msgs); n > 0 && msgs[n-1].Role == "user" {
+				if blocks, ok := msgs[n-1].Content.([]anthropicBlock); ok && len(blocks) > 0 && blocks[0].Type == "tool_result" {
+					msgs[n-1].Content = append(blocks, block)
+					continue
+				}
+			}
+			msgs = append(msgs, anthropicMsg{Role: "user", Content: []anthropicBlock{block}})
+		case len(m.ToolCalls) > 0:
+			var blocks []anthropicBlock
+			if m.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: m.Content})
+			}
+			for _, tc := range m.ToolCalls {
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: tc.ID, Name: tc.Name, Input: toolArgs(tc.Arguments)})
+			}
+			msgs = append(msgs, anthropicMsg{Role: m.Role, Content: blocks})
+		case len(m.Images) > 0:
+			var blocks []anthropicBlock
+			for _, img := range m.Images {
+				blocks = append(blocks, anthropicBlock{Type: "image", Source: &anthropicImageSource{Type: "base64", MediaType: img.MimeType, Data: img.Data}})
+			}
+			if m.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: m.Content})
+			}
+			msgs = append(msgs, anthropicMsg{Role: m.Role, Content: blocks})
+		default:
+			msgs = append(msgs, anthropicMsg{Role: m.Role, Content: m.Content})
+		}
+	}
+
+	// no native JSON mode; ask for it in the system prompt
+	if in.ResponseFormat != nil {
+		system = append(system, in.ResponseFormat.instruction())
+	}
+
+	var tools []anthropicTool
+	if stream {
+		in.Tools = nil // tool_use blocks aren't parsed from streams
+	}
+	for _, t := range in.Tools {
+		schema := t.Parameters
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type":"object"}`)
+		}
+		tools = append(tools, anthropicTool{Name: t.Name, Description: t.Description, InputSchema: schema})
+	}
+
+	maxTokens := p.MaxTokens
+	if in.Options.MaxTokens != nil {
+		maxTokens = *in.Options.MaxTokens
+	}
+
+	return anthropicChatReq{
+		Model:         model,
+		System:        strings.Join(system, "\n\n"),
+		Messages:      msgs,
+		Tools:         tools,
+		MaxTokens:     maxTokens,
+		Stream:        stream,
+		Temperature:   in.Options.Temperature,
+		TopP:          in.Options.TopP,
+		StopSequences: in.Options.Stop,
+	}, nil
+}
+
+func (p *AnthropicProvider) do(ctx context.Context, client *http.Client, path string, body any) (*http.Response, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	url := strings.TrimRight(p.BaseURL, "/") + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", p.APIKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, newStatusError("anthropic", resp, func(raw []byte) string {
+			var decoded anthropicChatResp
+			if json.Unmarshal(raw, &decoded) == nil && decoded.Error != nil {
+				return decoded.Error.Message
+			}
+			return ""
+		})
+	}
+	return resp, nil
+}
+
+func (p *AnthropicProvider) Chat(ctx context.Context, in ChatRequest) (ChatResponse, error) {
+	body, err := p.buildRequest(in, false)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+
+	resp, err := p.do(ctx, p.Client, "/v1/messages", body)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var decoded anthropicChatResp
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return ChatResponse{}, err
+	}
+	if decoded.Error != nil && decoded.Error.Message != "" {
+		return ChatResponse{}, newBackendError("anthropic", 0, decoded.Error.Message)
+	}
+
+	var out ChatResponse
+	var b strings.Builder
+	for _, c := range decoded.Content {
+		switch c.Type {
+		case "text":
+			b.WriteString(c.Text)
+		case "tool_use":
+			out.ToolCalls = append(out.ToolCalls, ToolCall{ID: c.ID, Name: c.Name, Arguments: toolArgs(c.Input)})
+		}
+	}
+	out.Content = b.String()
+	out.Usage = Usage{PromptTokens: decoded.Usage.InputTokens, CompletionTokens: decoded.Usage.OutputTokens}
+	return out, nil
+}
+
+// StreamChat streams assistant text and thinking deltas from
+// `content_block_delta` events.
+func (p *AnthropicProvider) StreamChat(ctx context.Context, in ChatRequest) iter.Seq2[Chunk, error] {
+	return func(yield func(Chunk, error) bool) {
+		body, err := p.buildRequest(in, true)
+		if err != nil {
+			yield(Chunk{}, err)
+			return
+		}
+
+		resp, err := p.do(ctx, streamClient(p.Client), "/v1/messages", body)
+		if err != nil {
+			yield(Chunk{}, err)
+			return
+		}
+		defer resp.Body.Close()
+
+		sc := bufio.NewScanner(resp.Body)
+		buf := make([]byte, 0, 64*1024)
+		sc.Buffer(buf, 2*1024*1024)
+
+		var usage Usage
+		var finish string
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" || !strings.HasPrefix(line, "data:") {
+				continue
+			}
+			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+
+			var ev anthropicStreamEvent
+			if err := json.Unmarshal([]byte(data), &ev); err != nil {
+				yield(Chunk{}, err)
+				return
+			}
+
+			switch ev.Type {
+			case "message_start":
+				usage.PromptTokens = ev.Message.Usage.InputTokens
+			case "message_delta":
+				usage.CompletionTokens = ev.Usage.OutputTokens
+				finish = anthropicFinishReason(ev.Delta.StopReason)
+			case "content_block_delta":
+				var c Chunk
+				switch ev.Delta.Type {
+				case "text_delta":
+					c.Delta = ev.Delta.Text
+				case "thinking_delta":
+					c.Reasoning = ev.Delta.Thinking
+				}
+				if c.Delta != "" || c.Reasoning != "" {
+					if !yield(c, nil) {
+						return
+					}
+				}
+			case "error":
+				msg := "stream error"
+				if ev.Error != nil && ev.Error.Message != "" {
+					msg = ev.Error.Message
+				}
+				yield(Chunk{}, newBackendError("anthropic", anthropicErrorStatus(ev.Error), msg))
+				return
+			case "message_stop":
+				yield(finalChunk(finish, usage), nil)
+				return
+			}
+		}
+
+		if err := sc.Err(); err != nil {
+			yield(Chunk{}, err)
+			return
+		}
+		yield(Chunk{}, errors.New("anthropic: stream ended before message_stop"))
+	}
+}
+
+// anthropicFinishReason maps a stop_reason to a Finish constant.
+func anthropicFinishReason(reason string) string {
+	switch reason {
+	case "max_tokens":
+		return FinishLength
+	case "tool_use":
+		return FinishToolCalls
+	case "refusal":
+		return FinishContentFilter
+	}
+	return FinishStop
+}
+
+type anthropicCountReq struct {
+	Model    string          `json:"model"`
+	System   string          `json:"system,omitempty"`
+	Messages []anthropicMsg  `json:"messages"`
+	Tools    []anthropicTool `json:"tools,omitempty"`
+}
+
+// CountTokens asks /v1/messages/count_tokens for the exact prompt size.
+func (p *AnthropicProvider) CountTokens(ctx context.Context, in ChatRequest) (int, error) {
+	body, err := p.buildRequest(in, false)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := p.do(ctx, p.Client, "/v1/messages/count_tokens", anthropicCountReq{
+		Model:    body.Model,
+		System:   body.System,
+		Messages: body.Messages,
+		Tools:    body.Tools,
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var decoded struct {
+		InputTokens int `json:"input_tokens"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return 0, err
+	}
+	return decoded.InputTokens, nil
+}
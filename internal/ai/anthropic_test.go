@@ -0,0 +1,92 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAnthropicChat_LiftsSystemMessages(t *testing.T) {
+	var got anthropicChatReq
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if r.Header.Get("x-api-key") != "k" || r.Header.Get("anthropic-version") == "" {
+			t.Errorf("missing auth headers: %v", r.Header)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		fmt.Fprint(w, `{"content":[{"type":"text","text":"hello "},{"type":"text","text":"there"}]}`)
+	}))
+	defer srv.Close()
+
+	p := NewAnthropicProvider(srv.URL, "k", "claude-test", 0)
+	resp, err := p.Chat(context.Background(), ChatRequest{Messages: []Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: "hi"},
+	}})
+	if err != nil {
+		t.Fatalf("chat: %v", err)
+	}
+	if resp.Content != "hello there" {
+		t.Fatalf("unexpected reply: %q", resp.Content)
+	}
+	if got.System != "be brief" {
+		t.Fatalf("expected system to be lifted, got %q", got.System)
+	}
+	if len(got.Messages) != 1 || got.Messages[0].Role != "user" {
+		t.Fatalf("unexpected messages: %+v", got.Messages)
+	}
+	if got.MaxTokens <= 0 {
+		t.Fatalf("expected max_tokens to be set")
+	}
+}
+
+func TestAnthropicStreamChat_ContentBlockDeltas(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			`{"type":"message_start","message":{"id":"msg_1","usage":{"input_tokens":7,"output_tokens":1}}}`,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			`{"type":"ping"}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo"}}`,
+			`{"type":"content_block_stop","index":0}`,
+			`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":2}}`,
+			`{"type":"message_stop"}`,
+		}
+		for _, e := range events {
+			var ev struct{ Type string }
+			_ = json.Unmarshal([]byte(e), &ev)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, e)
+		}
+	}))
+	defer srv.Close()
+
+	p := NewAnthropicProvider(srv.URL, "k", "claude-test", 0)
+	var b strings.Builder
+	var usage *Usage
+	var finish string
+	for c, err := range p.StreamChat(context.Background(), ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}}) {
+		if err != nil {
+			t.Fatalf("stream: %v", err)
+		}
+		b.WriteString(c.Delta)
+		if c.Usage != nil {
+			usage = c.Usage
+		}
+		finish = c.FinishReason
+	}
+	if b.String() != "Hello" || finish != FinishStop {
+		t.Fatalf("unexpected stream output: %q (finish %q)", b.String(), finish)
+	}
+	if usage == nil || usage.PromptTokens != 7 || usage.CompletionTokens != 2 {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+}
@@ -0,0 +1,189 @@
+package ai
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrProviderUnavailable is returned without contacting the backend while its
+// circuit is open. It is a kind of ErrUpstreamUnavailable.
+var ErrProviderUnavailable = fmt.Errorf("%w: circuit open", ErrUpstreamUnavailable)
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+type BreakerConfig struct {
+	// FailureThreshold consecutive failures open the circuit.
+	FailureThreshold int
+	// Cooldown is how long an open circuit rejects requests before letting a probe through.
+	Cooldown time.Duration
+}
+
+// BreakerStatus is a snapshot of one backend's circuit.
+type BreakerStatus struct {
+	Key                 string       `json:"key"`
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	LastError           string       `json:"last_error,omitempty"`
+	OpenedAt            *time.Time   `json:"opened_at,omitempty"`
+}
+
+type breaker struct {
+	mu       sync.Mutex
+	cfg      BreakerConfig
+	state    BreakerState
+	failures int
+	lastErr  string
+	openedAt time.Time
+	// probing is true while the single half-open request is in flight
+	probing bool
+}
+
+// allow reports whether a request may go through, moving an open circuit to
+// half-open once its cool-down has elapsed.
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if now.Sub(b.openedAt) < b.cfg.Cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+func (b *breaker) record(now time.Time, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if err == nil {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	b.lastErr = err.Error()
+	if b.state == BreakerHalfOpen || b.failures >= b.cfg.FailureThreshold {
+		b.state = BreakerOpen
+		b.openedAt = now
+	}
+}
+
+// release gives up a half-open probe that ended without a verdict (e.g. the
+// caller canceled), so the next request can probe instead.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *breaker) status(key string) BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := BreakerStatus{Key: key, State: b.state, ConsecutiveFailures: b.failures, LastError: b.lastErr}
+	if b.state != BreakerClosed {
+		t := b.openedAt
+		st.OpenedAt = &t
+	}
+	return st
+}
+
+// Breakers holds one circuit per backend, keyed by provider and base URL.
+type Breakers struct {
+	cfg BreakerConfig
+	now func() time.Time
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+func NewBreakers(cfg BreakerConfig) *Breakers {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = 30 * time.Second
+	}
+	return &Breakers{cfg: cfg, now: time.Now, breakers: make(map[string]*breaker)}
+}
+
+func (bs *Breakers) get(key string) *breaker {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	b, ok := bs.breakers[key]
+	if !ok {
+		b = &breaker{cfg: bs.cfg, state: BreakerClosed}
+		bs.breakers[key] = b
+	}
+	return b
+}
+
+// Status returns every known circuit, sorted by key.
+func (bs *Breakers) Status() []BreakerStatus {
+	bs.mu.Lock()
+	keys := make([]string, 0, len(bs.breakers))
+	for k := range bs.breakers {
+		keys = append(keys, k)
+	}
+	bs.mu.Unlock()
+	sort.Strings(keys)
+
+	out := make([]BreakerStatus, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, bs.get(k).status(k))
+	}
+	return out
+}
+
+// Transport wraps next so requests fail fast with ErrProviderUnavailable while
+// key's circuit is open. Connection errors and 5xx responses count as failures;
+// 4xx (including 429) mean the backend is up.
+func (bs *Breakers) Transport(key string, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &breakerTransport{key: key, b: bs.get(key), now: bs.now, next: next}
+}
+
+type breakerTransport struct {
+	key  string
+	b    *breaker
+	now  func() time.Time
+	next http.RoundTripper
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.b.allow(t.now()) {
+		return nil, fmt.Errorf("%w: circuit open for %s", ErrProviderUnavailable, t.key)
+	}
+	resp, err := t.next.RoundTrip(req)
+	switch {
+	case err != nil && req.Context().Err() != nil:
+		t.b.release()
+	case err != nil:
+		t.b.record(t.now(), err)
+	case resp.StatusCode >= 500:
+		t.b.record(t.now(), fmt.Errorf("status %d", resp.StatusCode))
+	default:
+		t.b.record(t.now(), nil)
+	}
+	return resp, err
+}
@@ -0,0 +1,55 @@
+package ai
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreakerTransport_OpensAndRecovers(t *testing.T) {
+	var hits, status atomic.Int32
+	status.Store(500)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+
+	now := time.Unix(0, 0)
+	bs := NewBreakers(BreakerConfig{FailureThreshold: 2, Cooldown: time.Minute})
+	bs.now = func() time.Time { return now }
+	client := &http.Client{Transport: bs.Transport("test|"+srv.URL, nil)}
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		resp.Body.Close()
+	}
+	if st := bs.Status()[0]; st.State != BreakerOpen {
+		t.Fatalf("expected open circuit, got %+v", st)
+	}
+
+	if _, err := client.Get(srv.URL); !errors.Is(err, ErrProviderUnavailable) {
+		t.Fatalf("expected ErrProviderUnavailable, got %v", err)
+	}
+	if hits.Load() != 2 {
+		t.Fatalf("open circuit should not reach the backend, hits=%d", hits.Load())
+	}
+
+	// after the cool-down a successful probe closes the circuit
+	now = now.Add(time.Minute)
+	status.Store(200)
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	resp.Body.Close()
+	if st := bs.Status()[0]; st.State != BreakerClosed || st.ConsecutiveFailures != 0 {
+		t.Fatalf("expected closed circuit, got %+v", st)
+	}
+}
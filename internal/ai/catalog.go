@@ -0,0 +1,186 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ModelInfo describes a model offered by a backend. Fields a backend doesn't
+// report are left empty.
+type ModelInfo struct {
+	Provider string `json:"provider"`
+	ID       string `json:"id"`
+	Name     string `json:"name,omitempty"`
+	// ContextLength is the context window in tokens.
+	ContextLength int `json:"context_length,omitempty"`
+	// InputModalities are e.g. "text", "image".
+	InputModalities []string      `json:"input_modalities,omitempty"`
+	Pricing         *ModelPricing `json:"pricing,omitempty"`
+}
+
+// ModelPricing is in USD per token, as reported by the backend.
+type ModelPricing struct {
+	Prompt     string `json:"prompt"`
+	Completion string `json:"completion"`
+}
+
+// ModelLister is implemented by providers that can discover their models.
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]ModelInfo, error)
+}
+
+// ErrUnknownModel is returned by Catalog.Check for a model the provider
+// doesn't list.
+var ErrUnknownModel = errors.New("ai: unknown model")
+
+// failedListTTL bounds how long a failed listing is remembered, so a backend
+// that is down isn't queried on every lookup.
+const failedListTTL = 30 * time.Second
+
+// listTimeout bounds a single discovery request.
+const listTimeout = 5 * time.Second
+
+// Catalog caches the models of every registered provider that implements
+// ModelLister.
+type Catalog struct {
+	reg *Registry
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*catalogEntry
+}
+
+type catalogEntry struct {
+	mu      sync.Mutex
+	fetched time.Time
+	models  []ModelInfo
+	// listed is false for providers that can't list their models
+	listed bool
+	err    error
+}
+
+func NewCatalog(reg *Registry, ttl time.Duration) *Catalog {
+	return &Catalog{reg: reg, ttl: ttl, now: time.Now, entries: make(map[string]*catalogEntry)}
+}
+
+// Models returns the cached models of every provider, refreshing stale
+// entries. Providers whose listing failed are returned as unavailable.
+func (c *Catalog) Models(ctx context.Context) (models []ModelInfo, unavailable []string) {
+	models = []ModelInfo{}
+	for _, name := range c.reg.Names() {
+		e := c.load(ctx, name)
+		if e.err != nil {
+			unavailable = append(unavailable, name)
+			continue
+		}
+		models = append(models, e.models...)
+	}
+	return models, unavailable
+}
+
+// Check reports whether provider/model can be served. Unknown providers
+// and models outside the provider's allowlist are rejected; otherwise a model
+// is only rejected when its provider lists models and the listing succeeded
+// without it.
+func (c *Catalog) Check(ctx context.Context, provider, model string) error {
+	provider = strings.ToLower(strings.TrimSpace(provider))
+	if !c.reg.Has(provider) {
+		return fmt.Errorf("unknown ai provider: %s", provider)
+	}
+	if !c.reg.Allowed(provider, model) {
+		return fmt.Errorf("%w: %s:%s", ErrUnknownModel, provider, model)
+	}
+	e := c.load(ctx, provider)
+	if !e.listed || e.err != nil || model == "" {
+		return nil
+	}
+	for _, m := range e.models {
+		// ollama resolves an untagged name to :latest
+		if m.ID == model || m.ID == model+":latest" {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s:%s", ErrUnknownModel, provider, model)
+}
+
+// ContextLength returns the context window of provider/model as listed by
+// its backend, or 0 when unknown.
+func (c *Catalog) ContextLength(ctx context.Context, provider, model string) int {
+	provider = strings.ToLower(strings.TrimSpace(provider))
+	if !c.reg.Has(provider) {
+		return 0
+	}
+	for _, m := range c.load(ctx, provider).models {
+		if m.ID == model || m.ID == model+":latest" {
+			return m.ContextLength
+		}
+	}
+	return 0
+}
+
+// Invalidate drops the cached models of provider, so the next lookup lists
+// them again.
+func (c *Catalog) Invalidate(provider string) {
+	provider = strings.ToLower(strings.TrimSpace(provider))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, provider)
+}
+
+// load returns a snapshot of the provider's entry, refreshing it if stale.
+func (c *Catalog) load(ctx context.Context, provider string) catalogEntry {
+	c.mu.Lock()
+	e, ok := c.entries[provider]
+	if !ok {
+		e = &catalogEntry{}
+		c.entries[provider] = e
+	}
+	c.mu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ttl := c.ttl
+	if e.err != nil && failedListTTL < ttl {
+		ttl = failedListTTL
+	}
+	if e.fetched.IsZero() || c.now().Sub(e.fetched) >= ttl {
+		// the result is shared and cached, so one caller going away must not
+		// turn it into a failure; fetch has its own timeout
+		e.models, e.listed, e.err = c.fetch(context.WithoutCancel(ctx), provider)
+		e.fetched = c.now()
+	}
+	return catalogEntry{models: e.models, listed: e.listed, err: e.err}
+}
+
+func (c *Catalog) fetch(ctx context.Context, provider string) ([]ModelInfo, bool, error) {
+	p, err := c.reg.Get(ctx, provider, "")
+	if err != nil {
+		return nil, false, err
+	}
+	l, ok := p.(ModelLister)
+	if !ok {
+		return nil, false, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, listTimeout)
+	defer cancel()
+	models, err := l.ListModels(ctx)
+	if err != nil {
+		return nil, true, err
+	}
+	allowed := models[:0]
+	for _, m := range models {
+		if c.reg.Allowed(provider, m.ID) {
+			m.Provider = provider
+			allowed = append(allowed, m)
+		}
+	}
+	models = allowed
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models, true, nil
+}
@@ -0,0 +1,80 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCatalog_OllamaTags(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != "/api/tags" {
+			t.Fatalf("unexpected path %s", r.URL.Path)
+		}
+		fmt.Fprint(w, `{"models":[{"name":"llava:7b","details":{"families":["llama","clip"]}},{"name":"llama3:latest","details":{"families":["llama"]}}]}`)
+	}))
+	defer srv.Close()
+
+	reg := NewRegistry()
+	reg.Register("ollama", func(ctx context.Context, model string) (Provider, error) {
+		return NewOllamaProvider(srv.URL, model), nil
+	})
+	reg.Register("stub", func(ctx context.Context, model string) (Provider, error) {
+		return &stubProvider{}, nil
+	})
+	cat := NewCatalog(reg, time.Minute)
+
+	models, unavailable := cat.Models(context.Background())
+	if len(unavailable) != 0 || len(models) != 2 {
+		t.Fatalf("expected 2 models, got %+v unavailable=%v", models, unavailable)
+	}
+	if m := models[1]; m.Provider != "ollama" || m.ID != "llava:7b" || len(m.InputModalities) != 2 {
+		t.Fatalf("unexpected model %+v", m)
+	}
+
+	if err := cat.Check(context.Background(), "ollama", "llama3"); err != nil {
+		t.Fatalf("untagged name should match :latest: %v", err)
+	}
+	if err := cat.Check(context.Background(), "ollama", "mistral"); !errors.Is(err, ErrUnknownModel) {
+		t.Fatalf("expected ErrUnknownModel, got %v", err)
+	}
+	if err := cat.Check(context.Background(), "stub", "anything"); err != nil {
+		t.Fatalf("providers that can't list should accept any model: %v", err)
+	}
+	if err := cat.Check(context.Background(), "nope", "m"); err == nil {
+		t.Fatalf("expected unknown provider to be rejected")
+	}
+	if calls != 1 {
+		t.Fatalf("expected cached listing, got %d calls", calls)
+	}
+}
+
+func TestCatalog_CallerCancelIsNotCached(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"models":[{"name":"llama3:latest"}]}`)
+	}))
+	defer srv.Close()
+
+	reg := NewRegistry()
+	reg.Register("ollama", func(ctx context.Context, model string) (Provider, error) {
+		return NewOllamaProvider(srv.URL, model), nil
+	})
+	cat := NewCatalog(reg, time.Minute)
+
+	// the client went away before the listing ran
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := cat.Check(ctx, "ollama", "llama3"); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	models, unavailable := cat.Models(context.Background())
+	if len(unavailable) != 0 || len(models) != 1 {
+		t.Fatalf("expected the backend to stay available, got %+v unavailable=%v", models, unavailable)
+	}
+}
@@ -0,0 +1,43 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+)
+
+// Embeddings are the vectors of a batch of inputs, in input order.
+type Embeddings struct {
+	Vectors [][]float32
+	// Dimensions is the length of every vector.
+	Dimensions int
+	Usage      Usage
+}
+
+// Embedder is an optional interface. Providers may implement text embeddings.
+type Embedder interface {
+	Embed(ctx context.Context, inputs []string) (Embeddings, error)
+}
+
+// embedBatchSize bounds the inputs sent in one backend request.
+const embedBatchSize = 64
+
+// embedBatches calls fn on consecutive batches of inputs and joins the results.
+func embedBatches(ctx context.Context, provider string, inputs []string, fn func(ctx context.Context, batch []string) (Embeddings, error)) (Embeddings, error) {
+	var out Embeddings
+	for start := 0; start < len(inputs); start += embedBatchSize {
+		end := min(start+embedBatchSize, len(inputs))
+		e, err := fn(ctx, inputs[start:end])
+		if err != nil {
+			return Embeddings{}, err
+		}
+		if len(e.Vectors) != end-start {
+			return Embeddings{}, fmt.Errorf("%s: got %d embeddings for %d inputs", provider, len(e.Vectors), end-start)
+		}
+		out.Vectors = append(out.Vectors, e.Vectors...)
+		out.Usage.PromptTokens += e.Usage.PromptTokens
+	}
+	if len(out.Vectors) > 0 {
+		out.Dimensions = len(out.Vectors[0])
+	}
+	return out, nil
+}
@@ -0,0 +1,53 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAIProvider_EmbedBatchesInOrder(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/embeddings" {
+			t.Fatalf("unexpected path %s", r.URL.Path)
+		}
+		var req openAIEmbedReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		// answer in reverse order; the vector encodes the input's length
+		var data []string
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			data = append(data, fmt.Sprintf(`{"index":%d,"embedding":[%d,0]}`, i, len(req.Input[i])))
+		}
+		fmt.Fprintf(w, `{"data":[%s],"usage":{"prompt_tokens":%d}}`, strings.Join(data, ","), len(req.Input))
+	}))
+	defer srv.Close()
+
+	inputs := make([]string, embedBatchSize+1)
+	for i := range inputs {
+		inputs[i] = strings.Repeat("x", i+1)
+	}
+	p := NewOpenAIProvider("test", srv.URL, "", "embed")
+	res, err := p.Embed(context.Background(), inputs)
+	if err != nil {
+		t.Fatalf("embed: %v", err)
+	}
+	if requests != 2 || len(res.Vectors) != len(inputs) || res.Dimensions != 2 {
+		t.Fatalf("expected 2 batches of %d vectors, got %d requests, %d vectors, %d dims", len(inputs), requests, len(res.Vectors), res.Dimensions)
+	}
+	for i, v := range res.Vectors {
+		if int(v[0]) != i+1 {
+			t.Fatalf("vector %d out of order: %v", i, v)
+		}
+	}
+	if res.Usage.PromptTokens != len(inputs) {
+		t.Fatalf("expected summed usage, got %d", res.Usage.PromptTokens)
+	}
+}
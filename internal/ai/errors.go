@@ -0,0 +1,153 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Error kinds. Backend errors wrap one of these when they can be classified;
+// use ErrorKind to get the kind of an arbitrary error.
+var (
+	ErrRateLimited         = errors.New("ai: rate limited")
+	ErrAuthFailed          = errors.New("ai: authentication failed")
+	ErrContextTooLong      = errors.New("ai: context too long")
+	ErrModelNotFound       = errors.New("ai: model not found")
+	ErrContentFiltered     = errors.New("ai: content filtered")
+	ErrUpstreamUnavailable = errors.New("ai: upstream unavailable")
+	ErrTimeout             = errors.New("ai: timeout")
+)
+
+var errorKinds = []error{
+	ErrRateLimited,
+	ErrAuthFailed,
+	ErrContextTooLong,
+	ErrModelNotFound,
+	ErrContentFiltered,
+	ErrUpstreamUnavailable,
+	ErrTimeout,
+}
+
+// StatusError is an error response from a backend: a non-2xx status, or an
+// error object inside a 200 body (StatusCode 0 unless the body carries one).
+type StatusError struct {
+	Provider   string
+	StatusCode int
+	// Message is the backend's error message, or "status <code>" when it sent none.
+	Message string
+	// Kind is one of the Err* kinds, nil when unclassified.
+	Kind error
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Provider, e.Message)
+}
+
+func (e *StatusError) Unwrap() error { return e.Kind }
+
+// newBackendError builds a classified StatusError.
+func newBackendError(provider string, status int, msg string) *StatusError {
+	if msg == "" {
+		msg = fmt.Sprintf("status %d", status)
+	}
+	return &StatusError{Provider: provider, StatusCode: status, Message: msg, Kind: classify(status, msg)}
+}
+
+// newStatusError reads a bounded error body; decode may extract a nicer
+// message from it.
+func newStatusError(provider string, resp *http.Response, decode func(raw []byte) string) *StatusError {
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4*1024))
+	msg := strings.TrimSpace(string(raw))
+	if decode != nil {
+		if m := decode(raw); m != "" {
+			msg = m
+		}
+	}
+	return newBackendError(provider, resp.StatusCode, msg)
+}
+
+// decodeErrorMessage understands the error bodies of Ollama ({"error":"..."})
+// and OpenAI-compatible servers such as OpenRouter ({"error":{"message":"..."}}).
+func decodeErrorMessage(raw []byte) string {
+	var body struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(raw, &body) != nil || len(body.Error) == 0 {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(body.Error, &s) == nil {
+		return s
+	}
+	var obj openAIError
+	if json.Unmarshal(body.Error, &obj) == nil {
+		return obj.Message
+	}
+	return ""
+}
+
+// classify maps a status code and error message onto an error kind. Messages
+// are checked first since many servers answer 400 for everything.
+func classify(status int, msg string) error {
+	m := strings.ToLower(msg)
+	switch {
+	case containsAny(m, "context length", "context window", "maximum context", "context_length_exceeded", "too many tokens", "prompt is too long", "input is too long"):
+		return ErrContextTooLong
+	case containsAny(m, "moderation", "flagged", "content policy", "content_filter", "safety"):
+		return ErrContentFiltered
+	case status == http.StatusNotFound, containsAny(m, "model not found", "no endpoints found") ||
+		(strings.Contains(m, "model") && strings.Contains(m, "not found")):
+		return ErrModelNotFound
+	}
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden || status == http.StatusPaymentRequired:
+		return ErrAuthFailed
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		return ErrTimeout
+	case status >= 500:
+		return ErrUpstreamUnavailable
+	}
+	return nil
+}
+
+func containsAny(s string, subs ...string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrorKind returns the kind of err, one of the Err* values, or nil when it
+// isn't a recognizable backend failure.
+func ErrorKind(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, k := range errorKinds {
+		if errors.Is(err, k) {
+			return k
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return ErrTimeout
+	}
+	var ue *url.Error
+	if errors.As(err, &ue) && !errors.Is(err, context.Canceled) {
+		return ErrUpstreamUnavailable
+	}
+	return nil
+}
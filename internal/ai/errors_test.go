@@ -0,0 +1,48 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorKind_BackendBodies(t *testing.T) {
+	cases := []struct {
+		status int
+		body   string
+		want   error
+	}{
+		// Ollama
+		{404, `{"error":"model \"llama9\" not found, try pulling it first"}`, ErrModelNotFound},
+		{500, `{"error":"llama runner process has terminated"}`, ErrUpstreamUnavailable},
+		// OpenRouter
+		{401, `{"error":{"code":401,"message":"No auth credentials found"}}`, ErrAuthFailed},
+		{429, `{"error":{"code":429,"message":"Rate limit exceeded"}}`, ErrRateLimited},
+		{403, `{"error":{"code":403,"message":"Input was flagged by moderation","metadata":{"reasons":["violence"]}}}`, ErrContentFiltered},
+		{400, `{"error":{"code":400,"message":"This endpoint's maximum context length is 8192 tokens"}}`, ErrContextTooLong},
+		{400, `{"error":{"code":400,"message":"bad temperature"}}`, nil},
+	}
+	for _, tc := range cases {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tc.status)
+			fmt.Fprint(w, tc.body)
+		}))
+		for _, p := range []Provider{NewOllamaProvider(srv.URL, "m"), NewOpenAIProvider("openrouter", srv.URL, "", "m")} {
+			_, err := p.Chat(context.Background(), ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}})
+			if err == nil {
+				t.Fatalf("%d %s: expected an error", tc.status, tc.body)
+			}
+			if got := ErrorKind(err); got != tc.want {
+				t.Fatalf("%d %s: got kind %v, want %v (err=%v)", tc.status, tc.body, got, tc.want, err)
+			}
+		}
+		srv.Close()
+	}
+
+	if !errors.Is(ErrProviderUnavailable, ErrUpstreamUnavailable) {
+		t.Fatalf("an open circuit should count as upstream unavailable")
+	}
+}
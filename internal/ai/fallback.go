@@ -0,0 +1,176 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"log"
+	"strings"
+)
+
+// Backend names a provider/model pair as registered in a Registry.
+type Backend struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+}
+
+func (b Backend) String() string {
+	return b.Provider + ":" + b.Model
+}
+
+// ParseBackends parses a chain like "ollama:llama3:latest,openrouter:openai/gpt-4o-mini".
+// Each entry is split on its first ':', so model names may contain colons.
+// An entry without a model uses the provider's default model.
+func ParseBackends(s string) ([]Backend, error) {
+	var out []Backend
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		provider, model, _ := strings.Cut(entry, ":")
+		provider = strings.ToLower(strings.TrimSpace(provider))
+		if provider == "" {
+			return nil, fmt.Errorf("invalid backend %q: provider is required", entry)
+		}
+		out = append(out, Backend{Provider: provider, Model: strings.TrimSpace(model)})
+	}
+	return out, nil
+}
+
+type fallbackTarget struct {
+	backend  Backend
+	provider Provider
+}
+
+// FallbackProvider tries an ordered list of backends, moving on to the next
+// one when a backend is unreachable, answers 5xx or rate-limits with 429.
+// Other errors (bad request, auth, safety blocks) are returned as is, since
+// another backend is unlikely to do better.
+type FallbackProvider struct {
+	targets []fallbackTarget
+}
+
+// Chain builds a provider for primary followed by fallbacks. Fallbacks equal
+// to the primary are skipped, and so are fallbacks that no longer resolve,
+// such as a backend removed from the providers file. With no fallbacks the
+// primary is returned as is.
+func (r *Registry) Chain(ctx context.Context, primary Backend, fallbacks []Backend) (Provider, error) {
+	p, err := r.Get(ctx, primary.Provider, primary.Model)
+	if err != nil {
+		return nil, err
+	}
+	fp := &FallbackProvider{targets: []fallbackTarget{{backend: primary, provider: p}}}
+	for _, b := range fallbacks {
+		if strings.EqualFold(b.Provider, primary.Provider) && b.Model == primary.Model {
+			continue
+		}
+		p, err := r.Get(ctx, b.Provider, b.Model)
+		if err != nil {
+			log.Printf("ai: skipping fallback %s/%s: %v", b.Provider, b.Model, err)
+			continue
+		}
+		fp.targets = append(fp.targets, fallbackTarget{backend: b, provider: p})
+	}
+	if len(fp.targets) == 1 {
+		return fp.targets[0].provider, nil
+	}
+	return fp, nil
+}
+
+// shouldFallback reports whether err means the backend is unavailable rather
+// than the request being wrong.
+func shouldFallback(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	switch ErrorKind(err) {
+	case ErrRateLimited, ErrUpstreamUnavailable, ErrTimeout:
+		return true
+	}
+	return false
+}
+
+func (p *FallbackProvider) Chat(ctx context.Context, in ChatRequest) (ChatResponse, error) {
+	var errs []error
+	for _, t := range p.targets {
+		resp, err := t.provider.Chat(ctx, in)
+		if err == nil {
+			b := t.backend
+			resp.Backend = &b
+			return resp, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", t.backend, err))
+		if !shouldFallback(ctx, err) {
+			break
+		}
+	}
+	return ChatResponse{}, errors.Join(errs...)
+}
+
+// StreamChat falls back only until the first chunk has been received; after
+// that the client has seen output and errors are passed through.
+// Backends without streaming support answer through Chat in a single chunk.
+func (p *FallbackProvider) StreamChat(ctx context.Context, in ChatRequest) iter.Seq2[Chunk, error] {
+	return func(yield func(Chunk, error) bool) {
+		var failures []error
+		for _, t := range p.targets {
+			b := t.backend
+
+			sp, ok := t.provider.(StreamProvider)
+			if !ok {
+				resp, err := t.provider.Chat(ctx, in)
+				if err == nil {
+					reason := FinishStop
+					if len(resp.ToolCalls) > 0 {
+						reason = FinishToolCalls
+					}
+					yield(Chunk{Delta: resp.Content, Reasoning: resp.Reasoning, Usage: &resp.Usage, FinishReason: reason, Backend: &b}, nil)
+					return
+				}
+				failures = append(failures, fmt.Errorf("%s: %w", b, err))
+				if !shouldFallback(ctx, err) {
+					break
+				}
+				continue
+			}
+
+			started := false
+			var err error
+			for c, cerr := range sp.StreamChat(ctx, in) {
+				if cerr != nil {
+					err = cerr
+					break
+				}
+				started = true
+				c.Backend = &b
+				if !yield(c, nil) {
+					return
+				}
+			}
+			if err == nil {
+				return
+			}
+			if started {
+				yield(Chunk{}, fmt.Errorf("%s: %w", b, err))
+				return
+			}
+			failures = append(failures, fmt.Errorf("%s: %w", b, err))
+			if !shouldFallback(ctx, err) {
+				break
+			}
+		}
+		yield(Chunk{}, errors.Join(failures...))
+	}
+}
+
+// CountTokens counts with the primary backend, the one a request goes to
+// first.
+func (p *FallbackProvider) CountTokens(ctx context.Context, in ChatRequest) (int, error) {
+	tc, ok := p.targets[0].provider.(TokenCounter)
+	if !ok {
+		return 0, errNoTokenCounter
+	}
+	return tc.CountTokens(ctx, in)
+}
@@ -0,0 +1,122 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"testing"
+)
+
+type stubProvider struct {
+	reply string
+	err   error
+	calls int
+}
+
+func (p *stubProvider) Chat(ctx context.Context, in ChatRequest) (ChatResponse, error) {
+	p.calls++
+	if p.err != nil {
+		return ChatResponse{}, p.err
+	}
+	return ChatResponse{Content: p.reply}, nil
+}
+
+func (p *stubProvider) StreamChat(ctx context.Context, in ChatRequest) iter.Seq2[Chunk, error] {
+	return func(yield func(Chunk, error) bool) {
+		p.calls++
+		if p.err != nil {
+			yield(Chunk{}, p.err)
+			return
+		}
+		if yield(Chunk{Delta: p.reply}, nil) {
+			yield(finalChunk(FinishStop, Usage{}), nil)
+		}
+	}
+}
+
+func newStubRegistry(stubs map[string]*stubProvider) *Registry {
+	r := NewRegistry()
+	for name, p := range stubs {
+		r.Register(name, func(ctx context.Context, model string) (Provider, error) { return p, nil })
+	}
+	return r
+}
+
+func TestFallbackProvider_Chat(t *testing.T) {
+	down := &stubProvider{err: newBackendError("a", 503, "")}
+	bad := &stubProvider{err: newBackendError("b", 400, "bad request")}
+	up := &stubProvider{reply: "hi"}
+	r := newStubRegistry(map[string]*stubProvider{"down": down, "bad": bad, "up": up})
+
+	p, err := r.Chain(context.Background(), Backend{Provider: "down", Model: "m1"}, []Backend{{Provider: "up", Model: "m2"}})
+	if err != nil {
+		t.Fatalf("chain: %v", err)
+	}
+	resp, err := p.Chat(context.Background(), ChatRequest{})
+	if err != nil {
+		t.Fatalf("chat: %v", err)
+	}
+	if resp.Content != "hi" || resp.Backend == nil || *resp.Backend != (Backend{Provider: "up", Model: "m2"}) {
+		t.Fatalf("expected reply from fallback, got %+v", resp)
+	}
+
+	// a 400 is the request's fault; don't try the next backend
+	up.calls = 0
+	p, _ = r.Chain(context.Background(), Backend{Provider: "bad"}, []Backend{{Provider: "up"}})
+	_, err = p.Chat(context.Background(), ChatRequest{})
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != 400 {
+		t.Fatalf("expected the 400 to be returned, got %v", err)
+	}
+	if up.calls != 0 {
+		t.Fatalf("fallback should not be called on 400")
+	}
+}
+
+func TestFallbackProvider_StreamBeforeFirstChunk(t *testing.T) {
+	down := &stubProvider{err: newBackendError("a", 429, "slow down")}
+	up := &stubProvider{reply: "hello"}
+	r := newStubRegistry(map[string]*stubProvider{"down": down, "up": up})
+
+	p, _ := r.Chain(context.Background(), Backend{Provider: "down"}, []Backend{{Provider: "up", Model: "m"}})
+	var got string
+	var backend *Backend
+	for c, err := range p.(StreamProvider).StreamChat(context.Background(), ChatRequest{}) {
+		if err != nil {
+			t.Fatalf("stream: %v", err)
+		}
+		got += c.Delta
+		backend = c.Backend
+	}
+	if got != "hello" || backend == nil || backend.Provider != "up" {
+		t.Fatalf("unexpected stream result %q from %+v", got, backend)
+	}
+}
+
+func TestChain_SkipsUnresolvableFallbacks(t *testing.T) {
+	down := &stubProvider{err: newBackendError("a", 503, "")}
+	up := &stubProvider{reply: "hi"}
+	r := newStubRegistry(map[string]*stubProvider{"down": down, "up": up})
+	r.AllowModels("up", []string{"m2"})
+
+	// "gone" was removed from the providers file, "up/m9" is no longer allowed
+	p, err := r.Chain(context.Background(), Backend{Provider: "down", Model: "m1"},
+		[]Backend{{Provider: "gone"}, {Provider: "up", Model: "m9"}, {Provider: "up", Model: "m2"}})
+	if err != nil {
+		t.Fatalf("chain: %v", err)
+	}
+	fp, ok := p.(*FallbackProvider)
+	if !ok || len(fp.targets) != 2 {
+		t.Fatalf("expected the primary and one fallback, got %+v", p)
+	}
+	resp, err := p.Chat(context.Background(), ChatRequest{})
+	if err != nil || resp.Content != "hi" {
+		t.Fatalf("expected reply from fallback, got %+v, %v", resp, err)
+	}
+
+	// only the primary left
+	p, err = r.Chain(context.Background(), Backend{Provider: "up", Model: "m2"}, []Backend{{Provider: "gone"}})
+	if err != nil || p != Provider(up) {
+		t.Fatalf("expected the primary as is, got %v, %v", p, err)
+	}
+}
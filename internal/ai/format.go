@@ -0,0 +1,132 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// ResponseFormat asks for a JSON reply, optionally matching a JSON Schema.
+type ResponseFormat struct {
+	// Type is "json" (any JSON object) or "json_schema".
+	Type string `json:"type"`
+	// Name identifies the schema to backends that want one.
+	Name   string          `json:"name,omitempty"`
+	Schema json.RawMessage `json:"schema,omitempty"`
+	// Retry re-prompts once with the validation error when the first reply
+	// doesn't match.
+	Retry bool `json:"retry,omitempty"`
+
+	// compiled is set by Validate.
+	compiled *jsonschema.Schema
+}
+
+const (
+	FormatJSON       = "json"
+	FormatJSONSchema = "json_schema"
+)
+
+// errInvalidSchema hides the compiler's error, which names files and URLs
+// of the server.
+var errInvalidSchema = errors.New("invalid response_format.schema")
+
+// ErrInvalidJSONOutput is wrapped by ParseJSONReply when a reply isn't
+// valid JSON or doesn't match the requested schema.
+var ErrInvalidJSONOutput = errors.New("ai: reply does not match response format")
+
+// Validate checks the format itself, including that the schema compiles,
+// and keeps the compiled schema for ParseJSONReply.
+func (f *ResponseFormat) Validate() error {
+	switch f.Type {
+	case FormatJSON:
+		return nil
+	case FormatJSONSchema:
+		if len(f.Schema) == 0 {
+			return errors.New("response_format.schema is required")
+		}
+		s, err := f.compile()
+		if err != nil {
+			return err
+		}
+		f.compiled = s
+		return nil
+	}
+	return fmt.Errorf("unknown response_format type %q", f.Type)
+}
+
+// compile compiles the schema on its own: a $ref to anything outside it,
+// such as a file or URL, is rejected rather than loaded.
+func (f *ResponseFormat) compile() (*jsonschema.Schema, error) {
+	c := jsonschema.NewCompiler()
+	c.LoadURL = func(url string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("external ref %s not allowed", url)
+	}
+	if err := c.AddResource("schema.json", strings.NewReader(string(f.Schema))); err != nil {
+		return nil, errInvalidSchema
+	}
+	s, err := c.Compile("schema.json")
+	if err != nil {
+		return nil, errInvalidSchema
+	}
+	return s, nil
+}
+
+func (f *ResponseFormat) schemaName() string {
+	if f.Name != "" {
+		return f.Name
+	}
+	return "response"
+}
+
+// ParseJSONReply extracts the JSON value from a reply, tolerating a
+// surrounding ``` fence, and validates it against the schema if any.
+func (f *ResponseFormat) ParseJSONReply(reply string) (json.RawMessage, error) {
+	text := strings.TrimSpace(reply)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```json")
+		text = strings.TrimPrefix(text, "```")
+		text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+		text = strings.TrimSpace(text)
+	}
+
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJSONOutput, err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("%w: trailing data after JSON value", ErrInvalidJSONOutput)
+	}
+
+	if f.Type == FormatJSONSchema {
+		if f.compiled == nil {
+			if err := f.Validate(); err != nil {
+				return nil, err
+			}
+		}
+		if err := f.compiled.Validate(v); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidJSONOutput, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(text)); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJSONOutput, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// instruction is added as a system message for backends without a native
+// JSON mode.
+func (f *ResponseFormat) instruction() string {
+	if f.Type == FormatJSONSchema {
+		return "Respond with a single JSON value that matches this JSON Schema, and nothing else:\n" + string(f.Schema)
+	}
+	return "Respond with a single JSON object and nothing else."
+}
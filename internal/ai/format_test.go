@@ -0,0 +1,38 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestResponseFormat_RejectsExternalRefs(t *testing.T) {
+	for _, ref := range []string{"file:///etc/passwd", "http://127.0.0.1:1/schema.json", "other.json"} {
+		f := &ResponseFormat{Type: FormatJSONSchema, Schema: json.RawMessage(`{"$ref":"` + ref + `"}`)}
+		err := f.Validate()
+		if err == nil {
+			t.Fatalf("%s: want error", ref)
+		}
+		if err.Error() != "invalid response_format.schema" || strings.Contains(err.Error(), "/") {
+			t.Fatalf("%s: error leaks details: %v", ref, err)
+		}
+	}
+}
+
+func TestResponseFormat_CompilesOnce(t *testing.T) {
+	f := &ResponseFormat{Type: FormatJSONSchema, Schema: json.RawMessage(`{"type":"object","required":["a"],"properties":{"a":{"$ref":"#/$defs/n"}},"$defs":{"n":{"type":"integer"}}}`)}
+	if err := f.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	s := f.compiled
+	if _, err := f.ParseJSONReply("```json\n{\"a\": 1}\n```"); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if _, err := f.ParseJSONReply(`{"a":"x"}`); !errors.Is(err, ErrInvalidJSONOutput) {
+		t.Fatalf("want ErrInvalidJSONOutput, got %v", err)
+	}
+	if f.compiled != s {
+		t.Fatal("schema was compiled again")
+	}
+}
@@ -0,0 +1,408 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type GeminiProvider struct {
+	BaseURL string
+	APIKey  string
+	Model   string
+	Client  *http.Client
+}
+
+// GeminiBlockedError is returned when Gemini refuses to answer because of its
+// safety filters, either for the prompt itself or for the generated candidate.
+type GeminiBlockedError struct {
+	// Reason is Gemini's blockReason / finishReason, e.g. "SAFETY".
+	Reason string
+	// Prompt is true when the prompt was blocked before any generation.
+	Prompt bool
+}
+
+func (e *GeminiBlockedError) Unwrap() error { return ErrContentFiltered }
+
+func (e *GeminiBlockedError) Error() string {
+	if e.Prompt {
+		return fmt.Sprintf("gemini: prompt blocked (%s)", e.Reason)
+	}
+	return fmt.Sprintf("gemini: response blocked (%s)", e.Reason)
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	InlineData       *geminiBlob             `json:"inlineData,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     []byte `json:"data"` // base64 on the wire
+}
+
+type geminiFunctionCall struct {
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiFunctionDecl struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// parametersJsonSchema takes plain JSON Schema, unlike the OpenAPI-subset `parameters`.
+	Parameters json.RawMessage `json:"parametersJsonSchema,omitempty"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDecl `json:"functionDeclarations"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            *float64 `json:"topP,omitempty"`
+	MaxOutputTokens *int     `json:"maxOutputTokens,omitempty"`
+	StopSequences   []string `json:"stopSequences,omitempty"`
+	Seed            *int     `json:"seed,omitempty"`
+	// JSON mode
+	ResponseMimeType   string          `json:"responseMimeType,omitempty"`
+	ResponseJSONSchema json.RawMessage `json:"responseJsonSchema,omitempty"`
+}
+
+type geminiReq struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	Tools             []geminiTool            `json:"tools,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type geminiResp struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback *struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback,omitempty"`
+	// cumulative in streams: the last chunk holds the totals
+	UsageMetadata *struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+	} `json:"usageMetadata,omitempty"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error,omitempty"`
+}
+
+// finish reasons that mean the candidate was withheld by a filter
+var geminiBlockedFinishReasons = map[string]bool{
+	"SAFETY":             true,
+	"RECITATION":         true,
+	"BLOCKLIST":          true,
+	"PROHIBITED_CONTENT": true,
+	"SPII":               true,
+	"IMAGE_SAFETY":       true,
+}
+
+func NewGeminiProvider(baseURL, apiKey, model string) *GeminiProvider {
+	if baseURL == "" {
+		baseURL = "https://generativelanguage.googleapis.com/v1beta"
+	}
+	return &GeminiProvider{
+		BaseURL: baseURL,
+		APIKey:  apiKey,
+		Model:   model,
+		Client:  newHTTPClient(baseURL),
+	}
+}
+
+func (p *GeminiProvider) backendKey() string { return "gemini" + "|" + p.BaseURL }
+
+func (p *GeminiProvider) httpClient() *http.Client { return p.Client }
+
+// buildGeminiRequest maps our roles onto Gemini's: assistant -> model,
+// system -> systemInstruction, tool results -> user functionResponse parts.
+func buildGeminiRequest(in ChatRequest) geminiReq {
+	var req geminiReq
+	var system []geminiPart
+	for _, m := range in.Messages {
+		switch m.Role {
+		case "system":
+			system = append(system, geminiPart{Text: m.Content})
+		case "assistant":
+			var parts []geminiPart
+			if m.Content != "" || len(m.ToolCalls) == 0 {
+				parts = append(parts, geminiPart{Text: m.Content})
+			}
+			for _, tc := range m.ToolCalls {
+				parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{Name: tc.Name, Args: toolArgs(tc.Arguments)}})
+			}
+			req.Contents = append(req.Contents, geminiContent{Role: "model", Parts: parts})
+		case "tool":
+			// the response must be a JSON object; wrap anything else
+			resp := json.RawMessage(m.Content)
+			if !json.Valid(resp) || !strings.HasPrefix(strings.TrimSpace(m.Content), "{") {
+				resp, _ = json.Marshal(map[string]string{"content": m.Content})
+			}
+			part := geminiPart{FunctionResponse: &geminiFunctionResponse{Name: m.Name, Response: resp}}
+			if n := len(req.Contents); n > 0 && req.Contents[n-1].Role == "user" && req.Contents[n-1].Parts[0].FunctionResponse != nil {
+				req.Contents[n-1].Parts = append(req.Contents[n-1].Parts, part)
+				continue
+			}
+			req.Contents = append(req.Contents, geminiContent{Role: "user", Parts: []geminiPart{part}})
+		default:
+			var parts []geminiPart
+			if m.Content != "" || len(m.Images) == 0 {
+				parts = append(parts, geminiPart{Text: m.Content})
+			}
+			for _, img := range m.Images {
+				parts = append(parts, geminiPart{InlineData: &geminiBlob{MimeType: img.MimeType, Data: img.Data}})
+			}
+			req.Contents = append(req.Contents, geminiContent{Role: "user", Parts: parts})
+		}
+	}
+	if len(system) > 0 {
+		req.SystemInstruction = &geminiContent{Parts: system}
+	}
+	if o := in.Options; o.Temperature != nil || o.TopP != nil || o.MaxTokens != nil || len(o.Stop) > 0 || o.Seed != nil {
+		req.GenerationConfig = &geminiGenerationConfig{
+			Temperature:     o.Temperature,
+			TopP:            o.TopP,
+			MaxOutputTokens: o.MaxTokens,
+			StopSequences:   o.Stop,
+			Seed:            o.Seed,
+		}
+	}
+	if f := in.ResponseFormat; f != nil {
+		if req.GenerationConfig == nil {
+			req.GenerationConfig = &geminiGenerationConfig{}
+		}
+		req.GenerationConfig.ResponseMimeType = "application/json"
+		if f.Type == FormatJSONSchema {
+			req.GenerationConfig.ResponseJSONSchema = f.Schema
+		}
+	}
+	if len(in.Tools) > 0 {
+		var decls []geminiFunctionDecl
+		for _, t := range in.Tools {
+			decls = append(decls, geminiFunctionDecl{Name: t.Name, Description: t.Description, Parameters: t.Parameters})
+		}
+		req.Tools = []geminiTool{{FunctionDeclarations: decls}}
+	}
+	return req
+}
+
+func (p *GeminiProvider) do(ctx context.Context, client *http.Client, method string, query url.Values, body any) (*http.Response, error) {
+	if client == nil {
+		return nil, errors.New("gemini: http client is nil")
+	}
+	if strings.TrimSpace(p.APIKey) == "" {
+		return nil, errors.New("gemini: api key is required")
+	}
+	model := strings.TrimPrefix(strings.TrimSpace(p.Model), "models/")
+	if model == "" {
+		return nil, errors.New("gemini: model is required")
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	u := fmt.Sprintf("%s/models/%s:%s", strings.TrimRight(p.BaseURL, "/"), url.PathEscape(model), method)
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-goog-api-key", p.APIKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, newStatusError("gemini", resp, func(raw []byte) string {
+			var decoded geminiResp
+			if json.Unmarshal(raw, &decoded) == nil && decoded.Error != nil {
+				return decoded.Error.Message
+			}
+			return ""
+		})
+	}
+	return resp, nil
+}
+
+// result extracts the candidate text and function calls, turning filter
+// blocks into *GeminiBlockedError.
+func (r *geminiResp) result() (ChatResponse, error) {
+	if r.Error != nil && r.Error.Message != "" {
+		return ChatResponse{}, newBackendError("gemini", r.Error.Code, r.Error.Message)
+	}
+	if r.PromptFeedback != nil && r.PromptFeedback.BlockReason != "" {
+		return ChatResponse{}, &GeminiBlockedError{Reason: r.PromptFeedback.BlockReason, Prompt: true}
+	}
+	var out ChatResponse
+	if r.UsageMetadata != nil {
+		out.Usage = Usage{PromptTokens: r.UsageMetadata.PromptTokenCount, CompletionTokens: r.UsageMetadata.CandidatesTokenCount}
+	}
+	if len(r.Candidates) == 0 {
+		return out, nil
+	}
+	c := r.Candidates[0]
+	var b strings.Builder
+	for _, part := range c.Content.Parts {
+		b.WriteString(part.Text)
+		if part.FunctionCall != nil {
+			out.ToolCalls = append(out.ToolCalls, ToolCall{
+				ID:        newToolCallID(),
+				Name:      part.FunctionCall.Name,
+				Arguments: toolArgs(part.FunctionCall.Args),
+			})
+		}
+	}
+	out.Content = b.String()
+	if geminiBlockedFinishReasons[c.FinishReason] {
+		return out, &GeminiBlockedError{Reason: c.FinishReason}
+	}
+	return out, nil
+}
+
+func (p *GeminiProvider) Chat(ctx context.Context, in ChatRequest) (ChatResponse, error) {
+	resp, err := p.do(ctx, p.Client, "generateContent", nil, buildGeminiRequest(in))
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var decoded geminiResp
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return ChatResponse{}, err
+	}
+	if len(decoded.Candidates) == 0 && decoded.PromptFeedback == nil && decoded.Error == nil {
+		return ChatResponse{}, errors.New("gemini: empty response")
+	}
+	out, err := decoded.result()
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	return out, nil
+}
+
+// StreamChat streams candidate text via streamGenerateContent?alt=sse.
+func (p *GeminiProvider) StreamChat(ctx context.Context, in ChatRequest) iter.Seq2[Chunk, error] {
+	return func(yield func(Chunk, error) bool) {
+		in.Tools = nil
+		resp, err := p.do(ctx, streamClient(p.Client), "streamGenerateContent", url.Values{"alt": {"sse"}}, buildGeminiRequest(in))
+		if err != nil {
+			yield(Chunk{}, err)
+			return
+		}
+		defer resp.Body.Close()
+
+		sc := bufio.NewScanner(resp.Body)
+		buf := make([]byte, 0, 64*1024)
+		sc.Buffer(buf, 2*1024*1024)
+
+		var usage Usage
+		var finish string
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" || !strings.HasPrefix(line, "data:") {
+				continue
+			}
+			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+
+			var decoded geminiResp
+			if err := json.Unmarshal([]byte(data), &decoded); err != nil {
+				yield(Chunk{}, err)
+				return
+			}
+			out, err := decoded.result()
+			if out.Content != "" {
+				if !yield(Chunk{Delta: out.Content}, nil) {
+					return
+				}
+			}
+			if err != nil {
+				yield(Chunk{}, err)
+				return
+			}
+			if decoded.UsageMetadata != nil {
+				usage = out.Usage
+			}
+			if len(decoded.Candidates) > 0 && decoded.Candidates[0].FinishReason != "" {
+				finish = geminiFinishReason(decoded.Candidates[0].FinishReason)
+			}
+		}
+
+		if err := sc.Err(); err != nil {
+			yield(Chunk{}, err)
+			return
+		}
+		yield(finalChunk(finish, usage), nil)
+	}
+}
+
+// geminiFinishReason maps a finishReason to a Finish constant. Blocked
+// replies are reported as errors by result.
+func geminiFinishReason(reason string) string {
+	if reason == "MAX_TOKENS" {
+		return FinishLength
+	}
+	return FinishStop
+}
+
+type geminiCountReq struct {
+	GenerateContentRequest geminiCountContent `json:"generateContentRequest"`
+}
+
+type geminiCountContent struct {
+	Model string `json:"model"`
+	geminiReq
+}
+
+// CountTokens asks countTokens for the exact prompt size, system
+// instruction and tools included.
+func (p *GeminiProvider) CountTokens(ctx context.Context, in ChatRequest) (int, error) {
+	model := "models/" + strings.TrimPrefix(strings.TrimSpace(p.Model), "models/")
+	resp, err := p.do(ctx, p.Client, "countTokens", nil, geminiCountReq{
+		GenerateContentRequest: geminiCountContent{Model: model, geminiReq: buildGeminiRequest(in)},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var decoded struct {
+		TotalTokens int `json:"totalTokens"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return 0, err
+	}
+	return decoded.TotalTokens, nil
+}
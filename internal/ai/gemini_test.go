@@ -0,0 +1,148 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGeminiChat_MapsRolesAndSystem(t *testing.T) {
+	var got geminiReq
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models/gemini-test:generateContent" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if r.Header.Get("x-goog-api-key") != "k" {
+			t.Errorf("missing api key header: %v", r.Header)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		fmt.Fprint(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"hello "},{"text":"there"}]},"finishReason":"STOP"}],
+			"usageMetadata":{"promptTokenCount":9,"candidatesTokenCount":2}}`)
+	}))
+	defer srv.Close()
+
+	p := NewGeminiProvider(srv.URL, "k", "gemini-test")
+	resp, err := p.Chat(context.Background(), ChatRequest{Messages: []Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: "hi"},
+		{Role: "assistant", Content: "hey"},
+		{Role: "user", Content: "how are you?"},
+	}})
+	if err != nil {
+		t.Fatalf("chat: %v", err)
+	}
+	if resp.Content != "hello there" || resp.Usage.PromptTokens != 9 || resp.Usage.CompletionTokens != 2 {
+		t.Fatalf("unexpected reply: %+v", resp)
+	}
+	if got.SystemInstruction == nil || len(got.SystemInstruction.Parts) != 1 || got.SystemInstruction.Parts[0].Text != "be brief" {
+		t.Fatalf("expected system to be lifted, got %+v", got.SystemInstruction)
+	}
+	var roles []string
+	for _, c := range got.Contents {
+		roles = append(roles, c.Role)
+	}
+	if strings.Join(roles, ",") != "user,model,user" {
+		t.Fatalf("unexpected roles: %v", roles)
+	}
+}
+
+func TestGeminiChat_Blocked(t *testing.T) {
+	cases := []struct {
+		body   string
+		prompt bool
+	}{
+		{`{"promptFeedback":{"blockReason":"SAFETY"}}`, true},
+		{`{"candidates":[{"content":{"parts":[]},"finishReason":"SAFETY"}]}`, false},
+	}
+	for _, tc := range cases {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, tc.body)
+		}))
+		p := NewGeminiProvider(srv.URL, "k", "gemini-test")
+		_, err := p.Chat(context.Background(), ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}})
+		srv.Close()
+
+		var be *GeminiBlockedError
+		if !errors.As(err, &be) || be.Reason != "SAFETY" || be.Prompt != tc.prompt {
+			t.Fatalf("%s: expected a blocked error, got %v", tc.body, err)
+		}
+		if !errors.Is(err, ErrContentFiltered) {
+			t.Fatalf("%s: expected ErrContentFiltered, got %v", tc.body, err)
+		}
+	}
+}
+
+func TestGeminiStreamChat_SSE(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models/gemini-test:streamGenerateContent" || r.URL.Query().Get("alt") != "sse" {
+			t.Errorf("unexpected url %q", r.URL)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			`{"candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]}}],"usageMetadata":{"promptTokenCount":5,"candidatesTokenCount":1}}`,
+			`{"candidates":[{"content":{"role":"model","parts":[{"text":"lo"}]},"finishReason":"MAX_TOKENS"}],"usageMetadata":{"promptTokenCount":5,"candidatesTokenCount":3}}`,
+		}
+		for _, e := range events {
+			fmt.Fprintf(w, "data: %s\r\n\r\n", e)
+		}
+	}))
+	defer srv.Close()
+
+	p := NewGeminiProvider(srv.URL, "k", "gemini-test")
+	var b strings.Builder
+	var usage *Usage
+	var finish string
+	for c, err := range p.StreamChat(context.Background(), ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}}) {
+		if err != nil {
+			t.Fatalf("stream: %v", err)
+		}
+		b.WriteString(c.Delta)
+		if c.Usage != nil {
+			usage = c.Usage
+		}
+		finish = c.FinishReason
+	}
+	if b.String() != "Hello" || finish != FinishLength {
+		t.Fatalf("unexpected stream output: %q (finish %q)", b.String(), finish)
+	}
+	if usage == nil || usage.PromptTokens != 5 || usage.CompletionTokens != 3 {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+}
+
+func TestGeminiCountTokens(t *testing.T) {
+	var got geminiCountReq
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models/gemini-test:countTokens" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		fmt.Fprint(w, `{"totalTokens":42}`)
+	}))
+	defer srv.Close()
+
+	p := NewGeminiProvider(srv.URL, "k", "models/gemini-test")
+	n, err := p.CountTokens(context.Background(), ChatRequest{Messages: []Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: "hi"},
+	}})
+	if err != nil {
+		t.Fatalf("count tokens: %v", err)
+	}
+	if n != 42 {
+		t.Fatalf("unexpected count %d", n)
+	}
+	req := got.GenerateContentRequest
+	if req.Model != "models/gemini-test" || req.SystemInstruction == nil || len(req.Contents) != 1 {
+		t.Fatalf("unexpected countTokens request: %+v", req)
+	}
+}
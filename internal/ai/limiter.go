@@ -0,0 +1,250 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrBackendSaturated is returned without contacting the backend when all of
+// its slots are taken and the wait queue is full, or the wait timed out. It
+// is a kind of ErrRateLimited.
+var ErrBackendSaturated = fmt.Errorf("%w: backend saturated", ErrRateLimited)
+
+// SaturatedError is the ErrBackendSaturated of one backend.
+type SaturatedError struct {
+	Key string
+	// RetryAfter is a hint of when a slot is likely to be free.
+	RetryAfter time.Duration
+}
+
+func (e *SaturatedError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrBackendSaturated, e.Key)
+}
+
+func (e *SaturatedError) Unwrap() error { return ErrBackendSaturated }
+
+// RetryAfterHint returns the RetryAfter of a SaturatedError in err's chain.
+func RetryAfterHint(err error) (time.Duration, bool) {
+	var se *SaturatedError
+	if errors.As(err, &se) {
+		return se.RetryAfter, true
+	}
+	return 0, false
+}
+
+type LimiterConfig struct {
+	// MaxConcurrent requests per backend; 0 disables limiting.
+	MaxConcurrent int
+	// MaxQueue requests may wait for a slot; more are rejected at once.
+	MaxQueue int
+	// QueueTimeout bounds the wait for a slot.
+	QueueTimeout time.Duration
+}
+
+// LimiterStatus is a snapshot of one backend's limiter.
+type LimiterStatus struct {
+	Key           string `json:"key"`
+	InFlight      int    `json:"in_flight"`
+	Waiting       int    `json:"waiting"`
+	MaxConcurrent int    `json:"max_concurrent"`
+	MaxQueue      int    `json:"max_queue"`
+}
+
+type limiter struct {
+	key   string
+	cfg   LimiterConfig
+	slots chan struct{}
+
+	mu      sync.Mutex
+	waiting int
+}
+
+func (l *limiter) saturated() error {
+	return &SaturatedError{Key: l.key, RetryAfter: l.cfg.QueueTimeout}
+}
+
+// acquire takes a slot, waiting in the queue for up to QueueTimeout.
+func (l *limiter) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	l.mu.Lock()
+	if l.waiting >= l.cfg.MaxQueue {
+		l.mu.Unlock()
+		return l.saturated()
+	}
+	l.waiting++
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		l.waiting--
+		l.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(l.cfg.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return l.saturated()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *limiter) release() { <-l.slots }
+
+func (l *limiter) status() LimiterStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return LimiterStatus{
+		Key:           l.key,
+		InFlight:      len(l.slots),
+		Waiting:       l.waiting,
+		MaxConcurrent: l.cfg.MaxConcurrent,
+		MaxQueue:      l.cfg.MaxQueue,
+	}
+}
+
+// Limiters bound the concurrent requests of each backend, keyed by provider
+// and base URL like Breakers, so every path to a backend shares its slots.
+type Limiters struct {
+	cfg LimiterConfig
+
+	mu       sync.Mutex
+	limiters map[string]*limiter
+	// limits overrides cfg for some backends
+	limits map[string]LimiterConfig
+}
+
+func (cfg LimiterConfig) normalized() LimiterConfig {
+	if cfg.MaxQueue < 0 {
+		cfg.MaxQueue = 0
+	}
+	if cfg.QueueTimeout <= 0 {
+		cfg.QueueTimeout = 30 * time.Second
+	}
+	return cfg
+}
+
+func NewLimiters(cfg LimiterConfig) *Limiters {
+	return &Limiters{
+		cfg:      cfg.normalized(),
+		limiters: make(map[string]*limiter),
+		limits:   make(map[string]LimiterConfig),
+	}
+}
+
+// Default returns the config of backends without their own limit.
+func (ls *Limiters) Default() LimiterConfig {
+	return ls.cfg
+}
+
+// SetLimit gives the backend key its own config. Transports built before
+// keep the old limiter until they are rebuilt.
+func (ls *Limiters) SetLimit(key string, cfg LimiterConfig) {
+	cfg = cfg.normalized()
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.limits[key] = cfg
+	if l, ok := ls.limiters[key]; ok && l.cfg != cfg {
+		delete(ls.limiters, key)
+	}
+}
+
+func (ls *Limiters) configFor(key string) LimiterConfig {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if cfg, ok := ls.limits[key]; ok {
+		return cfg
+	}
+	return ls.cfg
+}
+
+func (ls *Limiters) get(key string) *limiter {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	l, ok := ls.limiters[key]
+	if !ok {
+		cfg, ok := ls.limits[key]
+		if !ok {
+			cfg = ls.cfg
+		}
+		l = &limiter{key: key, cfg: cfg, slots: make(chan struct{}, cfg.MaxConcurrent)}
+		ls.limiters[key] = l
+	}
+	return l
+}
+
+// Status returns every known limiter, sorted by key.
+func (ls *Limiters) Status() []LimiterStatus {
+	if ls == nil {
+		return nil
+	}
+	ls.mu.Lock()
+	keys := make([]string, 0, len(ls.limiters))
+	for k := range ls.limiters {
+		keys = append(keys, k)
+	}
+	ls.mu.Unlock()
+	sort.Strings(keys)
+
+	out := make([]LimiterStatus, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, ls.get(k).status())
+	}
+	return out
+}
+
+// Transport wraps next so that at most MaxConcurrent requests to key are in
+// flight. A slot is held until the response body is closed, so a stream
+// keeps its slot until it ends. Limiting is off when key's MaxConcurrent is 0.
+func (ls *Limiters) Transport(key string, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if ls == nil || ls.configFor(key).MaxConcurrent <= 0 {
+		return next
+	}
+	return &limiterTransport{l: ls.get(key), next: next}
+}
+
+type limiterTransport struct {
+	l    *limiter
+	next http.RoundTripper
+}
+
+func (t *limiterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.l.acquire(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.l.release()
+		return nil, err
+	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: sync.OnceFunc(t.l.release)}
+	return resp, nil
+}
+
+// releaseBody gives the slot back when the body is closed.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
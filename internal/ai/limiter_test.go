@@ -0,0 +1,91 @@
+package ai
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimiters_QueueAndReject(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	ls := NewLimiters(LimiterConfig{MaxConcurrent: 1, MaxQueue: 1, QueueTimeout: 50 * time.Millisecond})
+	client := &http.Client{Transport: ls.Transport("ollama|"+srv.URL, nil)}
+	get := func() error {
+		resp, err := client.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// holds the only slot until release
+	go get()
+	waitFor(t, func() bool { return ls.Status()[0].InFlight == 1 })
+
+	queued := make(chan error, 1)
+	go func() { queued <- get() }()
+	waitFor(t, func() bool { return ls.Status()[0].Waiting == 1 })
+
+	// the queue is full, so this one is turned away at once
+	err := get()
+	var se *SaturatedError
+	if !errors.As(err, &se) || se.RetryAfter != 50*time.Millisecond {
+		t.Fatalf("expected a saturated error, got %v", err)
+	}
+	if ErrorKind(err) != ErrRateLimited {
+		t.Fatalf("expected saturation to be rate limiting, got %v", ErrorKind(err))
+	}
+
+	// the queued one gives up after QueueTimeout
+	if err := <-queued; !errors.Is(err, ErrBackendSaturated) {
+		t.Fatalf("expected the queued request to time out, got %v", err)
+	}
+}
+
+func TestLimiters_SlotHeldUntilBodyClosed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	ls := NewLimiters(LimiterConfig{MaxConcurrent: 1, MaxQueue: 0, QueueTimeout: time.Second})
+	client := &http.Client{Transport: ls.Transport("ollama|"+srv.URL, nil)}
+
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if _, err := client.Get(srv.URL); !errors.Is(err, ErrBackendSaturated) {
+		t.Fatalf("expected the open body to hold the slot, got %v", err)
+	}
+	resp.Body.Close()
+	resp.Body.Close()
+
+	resp, err = client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("expected the slot back after close: %v", err)
+	}
+	resp.Body.Close()
+	if st := ls.Status(); len(st) != 1 || st[0].InFlight != 0 {
+		t.Fatalf("unexpected status %+v", st)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -7,8 +7,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"iter"
 	"net/http"
-	"time"
+	"strings"
 )
 
 type OllamaProvider struct {
@@ -20,10 +21,24 @@ type OllamaProvider struct {
 type ollamaStreamResp struct {
 	Message ollamaMsg `json:"message"`
 	Done    bool      `json:"done"`
-	Error   string    `json:"error,omitempty"`
+	// DoneReason is "stop" or "length" on the final response.
+	DoneReason string `json:"done_reason,omitempty"`
+	Error      string `json:"error,omitempty"`
+	ollamaCounts
+}
+
+// ollamaCounts are only present on the final (done) response.
+type ollamaCounts struct {
+	PromptEvalCount int `json:"prompt_eval_count,omitempty"`
+	EvalCount       int `json:"eval_count,omitempty"`
+}
+
+func (c ollamaCounts) usage() Usage {
+	return Usage{PromptTokens: c.PromptEvalCount, CompletionTokens: c.EvalCount}
 }
 
 func NewOllamaProvider(baseURL, model string) *OllamaProvider {
+	baseURL = strings.TrimRight(baseURL, "/")
 	if baseURL == "" {
 		baseURL = "http://localhost:11434"
 	}
@@ -33,130 +48,204 @@ func NewOllamaProvider(baseURL, model string) *OllamaProvider {
 	return &OllamaProvider{
 		BaseURL: baseURL,
 		Model:   model,
-		Client:  &http.Client{Timeout: 90 * time.Second},
+		Client:  newHTTPClient(baseURL),
 	}
 }
 
 type ollamaChatReq struct {
-	Model    string      `json:"model"`
-	Messages []ollamaMsg `json:"messages"`
-	Stream   bool        `json:"stream"`
+	Model    string         `json:"model"`
+	Messages []ollamaMsg    `json:"messages"`
+	Tools    []openAITool   `json:"tools,omitempty"` // same shape as OpenAI's
+	Stream   bool           `json:"stream"`
+	Options  *ollamaOptions `json:"options,omitempty"`
+	// Format is "json" or a JSON Schema object.
+	Format json.RawMessage `json:"format,omitempty"`
+}
+
+func toOllamaFormat(f *ResponseFormat) json.RawMessage {
+	switch {
+	case f == nil:
+		return nil
+	case f.Type == FormatJSONSchema:
+		return f.Schema
+	default:
+		return json.RawMessage(`"json"`)
+	}
+}
+
+type ollamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	NumPredict  *int     `json:"num_predict,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Seed        *int     `json:"seed,omitempty"`
+	NumCtx      *int     `json:"num_ctx,omitempty"`
+}
+
+func toOllamaOptions(o GenerationOptions) *ollamaOptions {
+	if o.Temperature == nil && o.TopP == nil && o.MaxTokens == nil && len(o.Stop) == 0 && o.Seed == nil && o.NumCtx == nil {
+		return nil
+	}
+	return &ollamaOptions{
+		Temperature: o.Temperature,
+		TopP:        o.TopP,
+		NumPredict:  o.MaxTokens,
+		Stop:        o.Stop,
+		Seed:        o.Seed,
+		NumCtx:      o.NumCtx,
+	}
 }
 
 type ollamaMsg struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"` // only in replies
+	Images    [][]byte         `json:"images,omitempty"`   // base64 on the wire
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+// ollamaToolCall has no ID; arguments are a JSON object rather than a string.
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
 }
 
 type ollamaChatResp struct {
 	Message ollamaMsg `json:"message"`
 	Error   string    `json:"error,omitempty"`
+	ollamaCounts
 }
 
-func (p *OllamaProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+func toOllamaMsgs(messages []Message) []ollamaMsg {
+	out := make([]ollamaMsg, 0, len(messages))
+	for _, m := range messages {
+		om := ollamaMsg{Role: m.Role, Content: m.Content}
+		if m.Role == "tool" {
+			om.ToolName = m.Name
+		}
+		for _, img := range m.Images {
+			om.Images = append(om.Images, img.Data)
+		}
+		for _, tc := range m.ToolCalls {
+			var otc ollamaToolCall
+			otc.Function.Name = tc.Name
+			otc.Function.Arguments = toolArgs(tc.Arguments)
+			om.ToolCalls = append(om.ToolCalls, otc)
+		}
+		out = append(out, om)
+	}
+	return out
+}
+
+func fromOllamaToolCalls(calls []ollamaToolCall) []ToolCall {
+	var out []ToolCall
+	for _, c := range calls {
+		out = append(out, ToolCall{
+			ID:        newToolCallID(),
+			Name:      c.Function.Name,
+			Arguments: toolArgs(c.Function.Arguments),
+		})
+	}
+	return out
+}
+
+func (p *OllamaProvider) backendKey() string { return "ollama" + "|" + p.BaseURL }
+
+func (p *OllamaProvider) httpClient() *http.Client { return p.Client }
+
+func (p *OllamaProvider) Chat(ctx context.Context, in ChatRequest) (ChatResponse, error) {
 	if p.Client == nil {
-		return "", errors.New("ollama: http client is nil")
+		return ChatResponse{}, errors.New("ollama: http client is nil")
 	}
 
 	reqBody := ollamaChatReq{
-		Model:  p.Model,
-		Stream: false,
-		Messages: func() []ollamaMsg {
-			out := make([]ollamaMsg, 0, len(messages))
-			for _, m := range messages {
-				out = append(out, ollamaMsg{Role: m.Role, Content: m.Content})
-			}
-			return out
-		}(),
+		Model:    p.Model,
+		Stream:   false,
+		Messages: toOllamaMsgs(in.Messages),
+		Tools:    toOpenAITools(in.Tools),
+		Options:  toOllamaOptions(in.Options),
+		Format:   toOllamaFormat(in.ResponseFormat),
 	}
 
 	b, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", err
+		return ChatResponse{}, err
 	}
 
 	url := fmt.Sprintf("%s/api/chat", p.BaseURL)
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
 	if err != nil {
-		return "", err
+		return ChatResponse{}, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := p.Client.Do(req)
 	if err != nil {
-		return "", err
+		return ChatResponse{}, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", fmt.Errorf("ollama: status %d", resp.StatusCode)
+		return ChatResponse{}, newStatusError("ollama", resp, decodeErrorMessage)
 	}
 
 	var decoded ollamaChatResp
 	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
-		return "", err
+		return ChatResponse{}, err
 	}
 	if decoded.Error != "" {
-		return "", errors.New(decoded.Error)
+		return ChatResponse{}, newBackendError("ollama", 0, decoded.Error)
 	}
-	return decoded.Message.Content, nil
+	return ChatResponse{
+		Content:   decoded.Message.Content,
+		Reasoning: decoded.Message.Thinking,
+		ToolCalls: fromOllamaToolCalls(decoded.Message.ToolCalls),
+		Usage:     decoded.usage(),
+	}, nil
 }
 
 // StreamChat streams assistant content chunks.
-// It returns immediately with two channels; both will be closed when streaming ends.
-func (p *OllamaProvider) StreamChat(ctx context.Context, messages []Message) (<-chan string, <-chan error) {
-	chunks := make(chan string, 16)
-	errs := make(chan error, 1)
-
-	go func() {
-		defer close(chunks)
-		defer close(errs)
-
+func (p *OllamaProvider) StreamChat(ctx context.Context, in ChatRequest) iter.Seq2[Chunk, error] {
+	return func(yield func(Chunk, error) bool) {
 		if p.Client == nil {
-			errs <- errors.New("ollama: http client is nil")
+			yield(Chunk{}, errors.New("ollama: http client is nil"))
 			return
 		}
 
 		reqBody := ollamaChatReq{
-			Model:  p.Model,
-			Stream: true,
-			Messages: func() []ollamaMsg {
-				out := make([]ollamaMsg, 0, len(messages))
-				for _, m := range messages {
-					out = append(out, ollamaMsg{Role: m.Role, Content: m.Content})
-				}
-				return out
-			}(),
+			Model:    p.Model,
+			Stream:   true,
+			Messages: toOllamaMsgs(in.Messages),
+			Options:  toOllamaOptions(in.Options),
+			Format:   toOllamaFormat(in.ResponseFormat),
 		}
 
 		b, err := json.Marshal(reqBody)
 		if err != nil {
-			errs <- err
+			yield(Chunk{}, err)
 			return
 		}
 
 		url := fmt.Sprintf("%s/api/chat", p.BaseURL)
 		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
 		if err != nil {
-			errs <- err
+			yield(Chunk{}, err)
 			return
 		}
 		req.Header.Set("Content-Type", "application/json")
 
-		// Ensure a reasonable timeout; streaming can be longer.
-		if p.Client.Timeout < 30*time.Second {
-			p.Client.Timeout = 0 // no global timeout; ctx controls it
-		}
-
-		resp, err := p.Client.Do(req)
+		resp, err := streamClient(p.Client).Do(req)
 		if err != nil {
-			errs <- err
+			yield(Chunk{}, err)
 			return
 		}
 		defer resp.Body.Close()
 
 		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			errs <- fmt.Errorf("ollama: status %d", resp.StatusCode)
+			yield(Chunk{}, newStatusError("ollama", resp, decodeErrorMessage))
 			return
 		}
 
@@ -173,28 +262,120 @@ func (p *OllamaProvider) StreamChat(ctx context.Context, messages []Message) (<-
 
 			var decoded ollamaStreamResp
 			if err := json.Unmarshal(line, &decoded); err != nil {
-				errs <- err
+				yield(Chunk{}, err)
 				return
 			}
 			if decoded.Error != "" {
-				errs <- errors.New(decoded.Error)
+				yield(Chunk{}, newBackendError("ollama", 0, decoded.Error))
 				return
 			}
 
-			if decoded.Message.Content != "" {
-				chunks <- decoded.Message.Content
+			if decoded.Message.Content != "" || decoded.Message.Thinking != "" {
+				if !yield(Chunk{Delta: decoded.Message.Content, Reasoning: decoded.Message.Thinking}, nil) {
+					return
+				}
 			}
 
 			if decoded.Done {
+				yield(finalChunk(decoded.DoneReason, decoded.usage()), nil)
 				return
 			}
 		}
 
 		if err := sc.Err(); err != nil {
-			errs <- err
+			yield(Chunk{}, err)
 			return
 		}
-	}()
+		yield(Chunk{}, errors.New("ollama: stream ended before done"))
+	}
+}
+
+type ollamaTagsResp struct {
+	Models []struct {
+		Name    string `json:"name"`
+		Details struct {
+			Families []string `json:"families"`
+		} `json:"details"`
+	} `json:"models"`
+}
 
-	return chunks, errs
+// ListModels returns the locally pulled models from /api/tags. Tags don't
+// carry the context length; vision models are recognised by their clip
+// projector.
+func (p *OllamaProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	if p.Client == nil {
+		return nil, errors.New("ollama: http client is nil")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/api/tags", p.BaseURL), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, newStatusError("ollama", resp, decodeErrorMessage)
+	}
+
+	var decoded ollamaTagsResp
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return nil, err
+	}
+	models := make([]ModelInfo, 0, len(decoded.Models))
+	for _, m := range decoded.Models {
+		mi := ModelInfo{ID: m.Name, Name: m.Name, InputModalities: []string{"text"}}
+		for _, f := range m.Details.Families {
+			if f == "clip" || f == "mllama" {
+				mi.InputModalities = append(mi.InputModalities, "image")
+				break
+			}
+		}
+		models = append(models, mi)
+	}
+	return models, nil
+}
+
+type ollamaEmbedReq struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type ollamaEmbedResp struct {
+	Embeddings      [][]float32 `json:"embeddings"`
+	PromptEvalCount int         `json:"prompt_eval_count,omitempty"`
+}
+
+// Embed uses /api/embed, which accepts a batch of inputs.
+func (p *OllamaProvider) Embed(ctx context.Context, inputs []string) (Embeddings, error) {
+	if p.Client == nil {
+		return Embeddings{}, errors.New("ollama: http client is nil")
+	}
+	return embedBatches(ctx, "ollama", inputs, func(ctx context.Context, batch []string) (Embeddings, error) {
+		b, err := json.Marshal(ollamaEmbedReq{Model: p.Model, Input: batch})
+		if err != nil {
+			return Embeddings{}, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/api/embed", p.BaseURL), bytes.NewReader(b))
+		if err != nil {
+			return Embeddings{}, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := p.Client.Do(req)
+		if err != nil {
+			return Embeddings{}, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return Embeddings{}, newStatusError("ollama", resp, decodeErrorMessage)
+		}
+
+		var decoded ollamaEmbedResp
+		if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+			return Embeddings{}, err
+		}
+		return Embeddings{Vectors: decoded.Embeddings, Usage: Usage{PromptTokens: decoded.PromptEvalCount}}, nil
+	})
 }
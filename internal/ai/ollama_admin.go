@@ -0,0 +1,167 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"time"
+)
+
+// Model management on a single Ollama node. p.Model is not used; every call
+// names its model.
+
+// PullProgress is one status line of a model pull. Total and Completed are
+// bytes of the layer named by Digest, when one is downloading.
+type PullProgress struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// RunningModel is a model loaded in memory, from /api/ps.
+type RunningModel struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	SizeVRAM  int64     `json:"size_vram"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// do sends a JSON request to the node and returns the response when its
+// status is 2xx. The caller closes the body.
+func (p *OllamaProvider) do(ctx context.Context, client *http.Client, method, path string, body any) (*http.Response, error) {
+	if client == nil {
+		return nil, errors.New("ollama: http client is nil")
+	}
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		rd = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s%s", p.BaseURL, path), rd)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, newStatusError("ollama", resp, decodeErrorMessage)
+	}
+	return resp, nil
+}
+
+// PullModel downloads a model, yielding Ollama's progress lines until the
+// pull succeeds. Pulls take minutes, so only ctx bounds them.
+func (p *OllamaProvider) PullModel(ctx context.Context, model string) iter.Seq2[PullProgress, error] {
+	return func(yield func(PullProgress, error) bool) {
+		resp, err := p.do(ctx, streamClient(p.Client), http.MethodPost, "/api/pull", map[string]any{"model": model, "stream": true})
+		if err != nil {
+			yield(PullProgress{}, err)
+			return
+		}
+		defer resp.Body.Close()
+
+		sc := bufio.NewScanner(resp.Body)
+		sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for sc.Scan() {
+			if len(sc.Bytes()) == 0 {
+				continue
+			}
+			var pr PullProgress
+			if err := json.Unmarshal(sc.Bytes(), &pr); err != nil {
+				yield(PullProgress{}, err)
+				return
+			}
+			if pr.Error != "" {
+				yield(PullProgress{}, newBackendError("ollama", 0, pr.Error))
+				return
+			}
+			if !yield(pr, nil) {
+				return
+			}
+			if pr.Status == "success" {
+				return
+			}
+		}
+		if err := sc.Err(); err != nil {
+			yield(PullProgress{}, err)
+			return
+		}
+		yield(PullProgress{}, errors.New("ollama: pull ended before success"))
+	}
+}
+
+// DeleteModel removes a pulled model; an unknown model is ErrModelNotFound.
+func (p *OllamaProvider) DeleteModel(ctx context.Context, model string) error {
+	resp, err := p.do(ctx, p.Client, http.MethodDelete, "/api/delete", map[string]any{"model": model})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// RunningModels lists the models loaded in memory.
+func (p *OllamaProvider) RunningModels(ctx context.Context) ([]RunningModel, error) {
+	resp, err := p.do(ctx, p.Client, http.MethodGet, "/api/ps", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var decoded struct {
+		Models []RunningModel `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return nil, err
+	}
+	return decoded.Models, nil
+}
+
+// ShowModel returns Ollama's description of a model (modelfile, parameters,
+// template, details, capabilities) as is.
+func (p *OllamaProvider) ShowModel(ctx context.Context, model string) (json.RawMessage, error) {
+	resp, err := p.do(ctx, p.Client, http.MethodPost, "/api/show", map[string]any{"model": model})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// Preload loads a model into memory and keeps it there for keepAlive after
+// its last use; a negative keepAlive keeps it until the node restarts and
+// zero unloads it. Loading a large model can outlast the client timeout, so
+// only ctx bounds the call.
+func (p *OllamaProvider) Preload(ctx context.Context, model string, keepAlive time.Duration) error {
+	var ka any = keepAlive.String()
+	if keepAlive < 0 {
+		ka = -1
+	}
+	// a generate request without a prompt only loads the model
+	resp, err := p.do(ctx, streamClient(p.Client), http.MethodPost, "/api/generate", map[string]any{"model": model, "keep_alive": ka, "stream": false})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,74 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOllamaProvider_PullModelStreamsProgress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/pull" {
+			t.Fatalf("unexpected path %s", r.URL.Path)
+		}
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["model"] == "missing" {
+			fmt.Fprintln(w, `{"status":"pulling manifest"}`)
+			fmt.Fprintln(w, `{"error":"pull model manifest: file does not exist"}`)
+			return
+		}
+		fmt.Fprintln(w, `{"status":"pulling manifest"}`)
+		fmt.Fprintln(w, `{"status":"pulling abc","digest":"sha256:abc","total":100,"completed":40}`)
+		fmt.Fprintln(w, `{"status":"success"}`)
+	}))
+	defer srv.Close()
+	p := NewOllamaProvider(srv.URL, "")
+
+	var got []PullProgress
+	for pr, err := range p.PullModel(context.Background(), "llama3") {
+		if err != nil {
+			t.Fatalf("pull: %v", err)
+		}
+		got = append(got, pr)
+	}
+	if len(got) != 3 || got[1].Completed != 40 || got[2].Status != "success" {
+		t.Fatalf("unexpected progress %+v", got)
+	}
+
+	var pullErr error
+	for _, err := range p.PullModel(context.Background(), "missing") {
+		pullErr = err
+	}
+	if pullErr == nil {
+		t.Fatalf("expected the error line to end the pull")
+	}
+}
+
+func TestOllamaProvider_PreloadKeepAlive(t *testing.T) {
+	var keepAlive []any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if _, ok := body["prompt"]; ok || r.URL.Path != "/api/generate" {
+			t.Fatalf("expected a prompt-less generate, got %s %v", r.URL.Path, body)
+		}
+		keepAlive = append(keepAlive, body["keep_alive"])
+		fmt.Fprint(w, `{"done":true}`)
+	}))
+	defer srv.Close()
+	p := NewOllamaProvider(srv.URL, "")
+
+	for _, d := range []time.Duration{4 * time.Hour, -1, 0} {
+		if err := p.Preload(context.Background(), "llama3", d); err != nil {
+			t.Fatalf("preload: %v", err)
+		}
+	}
+	if fmt.Sprint(keepAlive) != "[4h0m0s -1 0s]" {
+		t.Fatalf("unexpected keep_alive values %v", keepAlive)
+	}
+}
@@ -0,0 +1,436 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type affinityKey struct{}
+
+// WithAffinity tags ctx with a key, e.g. a chat session ID, that pools use to
+// send related requests to the same node.
+func WithAffinity(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, affinityKey{}, key)
+}
+
+func affinityFrom(ctx context.Context) string {
+	key, _ := ctx.Value(affinityKey{}).(string)
+	return key
+}
+
+// errNoOllamaNodes is returned by a pool without nodes.
+var errNoOllamaNodes = errors.New("ollama: no nodes configured")
+
+const (
+	// poolModelsTTL is how often a node's model lists are refreshed.
+	poolModelsTTL = 30 * time.Second
+	// maxAffinity bounds the remembered key -> node assignments; the map is
+	// reset when it grows past it.
+	maxAffinity = 10000
+)
+
+// OllamaPool spreads requests over several Ollama nodes. A request goes to
+// the healthy node with the fewest requests in flight among those that have
+// the model, preferring nodes that have it loaded. Requests with the same
+// affinity key stay on one node so its KV cache stays warm.
+//
+// Health is tracked passively: a node failing EjectAfter requests in a row
+// is left out for EjectFor. A request whose node is down or lacks the model
+// moves on to the next node, unless output was already streamed.
+type OllamaPool struct {
+	EjectAfter int
+	EjectFor   time.Duration
+
+	nodes []*ollamaNode
+	now   func() time.Time
+
+	mu       sync.Mutex
+	affinity map[string]*ollamaNode
+	// next rotates ties between equally loaded nodes
+	next int
+}
+
+type ollamaNode struct {
+	baseURL  string
+	client   *http.Client
+	inflight atomic.Int64
+
+	mu           sync.Mutex
+	failures     int
+	ejectedUntil time.Time
+	// pulled and loaded are nil until the first refresh succeeds, meaning
+	// "unknown"; keys are normalised with modelKey.
+	pulled      map[string]bool
+	loaded      map[string]bool
+	refreshedAt time.Time
+	refreshing  bool
+}
+
+func NewOllamaPool(baseURLs []string, ejectAfter int, ejectFor time.Duration) *OllamaPool {
+	if ejectAfter <= 0 {
+		ejectAfter = 3
+	}
+	if ejectFor <= 0 {
+		ejectFor = 30 * time.Second
+	}
+	p := &OllamaPool{
+		EjectAfter: ejectAfter,
+		EjectFor:   ejectFor,
+		now:        time.Now,
+		affinity:   make(map[string]*ollamaNode),
+	}
+	for _, u := range baseURLs {
+		u = strings.TrimRight(strings.TrimSpace(u), "/")
+		if u == "" {
+			continue
+		}
+		p.nodes = append(p.nodes, &ollamaNode{
+			baseURL: u,
+			client:  newHTTPClient(u),
+		})
+	}
+	return p
+}
+
+// Nodes returns the base URLs of the pool's nodes.
+func (p *OllamaPool) Nodes() []string {
+	out := make([]string, len(p.nodes))
+	for i, n := range p.nodes {
+		out[i] = n.baseURL
+	}
+	return out
+}
+
+// UseTransports puts each node behind its own circuit breaker, limiter and
+// retries, keyed like a single-URL ollama backend of the same node, as
+// Registry.Get does for other backends. A node with an open circuit or
+// without a free slot is passed over like one that is down. Nil ones are
+// left out.
+func (p *OllamaPool) UseTransports(bs *Breakers, ls *Limiters, retry *RetryConfig) {
+	for _, n := range p.nodes {
+		wrapClient(n.client, n.provider("").backendKey(), bs, ls, retry)
+	}
+}
+
+// Provider returns a provider for model that routes through the pool.
+func (p *OllamaPool) Provider(model string) *OllamaPoolProvider {
+	if model == "" {
+		model = "llama3:latest"
+	}
+	return &OllamaPoolProvider{Pool: p, Model: model}
+}
+
+// modelKey normalises Ollama model names: "llama3" and "llama3:latest" are
+// the same model.
+func modelKey(model string) string {
+	if !strings.Contains(model, ":") {
+		return model + ":latest"
+	}
+	return model
+}
+
+func (n *ollamaNode) provider(model string) *OllamaProvider {
+	return &OllamaProvider{BaseURL: n.baseURL, Model: model, Client: n.client}
+}
+
+func (n *ollamaNode) ejected(now time.Time) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return now.Before(n.ejectedUntil)
+}
+
+// has reports whether the node has model pulled and loaded; unknown lists
+// count as pulled.
+func (n *ollamaNode) has(model string) (pulled, loaded bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	key := modelKey(model)
+	return n.pulled == nil || n.pulled[key], n.loaded[key]
+}
+
+// forget marks model as missing on the node until the next refresh.
+func (n *ollamaNode) forget(model string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.pulled == nil {
+		n.pulled = make(map[string]bool)
+	}
+	n.pulled[modelKey(model)] = false
+}
+
+// refreshIfStale reloads the node's model lists in the background.
+func (n *ollamaNode) refreshIfStale(now time.Time) {
+	n.mu.Lock()
+	if n.refreshing || now.Sub(n.refreshedAt) < poolModelsTTL {
+		n.mu.Unlock()
+		return
+	}
+	n.refreshing = true
+	n.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), listTimeout)
+		defer cancel()
+		n.refresh(ctx)
+	}()
+}
+
+// refresh reloads the pulled and loaded models; a list that fails to load
+// keeps its previous value.
+func (n *ollamaNode) refresh(ctx context.Context) {
+	pulled, perr := n.provider("").ListModels(ctx)
+	loaded, lerr := n.provider("").RunningModels(ctx)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.refreshing = false
+	n.refreshedAt = time.Now()
+	if perr == nil {
+		n.pulled = make(map[string]bool, len(pulled))
+		for _, m := range pulled {
+			n.pulled[modelKey(m.ID)] = true
+		}
+	}
+	if lerr == nil {
+		n.loaded = make(map[string]bool, len(loaded))
+		for _, m := range loaded {
+			n.loaded[modelKey(m.Name)] = true
+		}
+	}
+}
+
+// record updates the node's health with the outcome of a request. Only
+// failures of the node itself count; a bad request says nothing about it.
+func (p *OllamaPool) record(n *ollamaNode, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err == nil {
+		n.failures = 0
+		return
+	}
+	switch ErrorKind(err) {
+	case ErrUpstreamUnavailable, ErrTimeout:
+	default:
+		return
+	}
+	n.failures++
+	if n.failures >= p.EjectAfter {
+		n.ejectedUntil = p.now().Add(p.EjectFor)
+		n.failures = 0
+	}
+}
+
+// pick chooses the node for a request, skipping tried nodes. When every
+// untried node is ejected it picks among them anyway rather than fail.
+func (p *OllamaPool) pick(ctx context.Context, model string, tried map[*ollamaNode]bool) *ollamaNode {
+	now := p.now()
+	var healthy, rest []*ollamaNode
+	for _, n := range p.nodes {
+		if tried[n] {
+			continue
+		}
+		n.refreshIfStale(now)
+		if n.ejected(now) {
+			rest = append(rest, n)
+		} else {
+			healthy = append(healthy, n)
+		}
+	}
+	if len(healthy) == 0 {
+		healthy = rest
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+
+	var withModel, warm []*ollamaNode
+	for _, n := range healthy {
+		pulled, loaded := n.has(model)
+		if pulled {
+			withModel = append(withModel, n)
+		}
+		if loaded {
+			warm = append(warm, n)
+		}
+	}
+	if len(withModel) == 0 {
+		withModel = healthy
+	}
+
+	key := affinityFrom(ctx)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key != "" {
+		if n := p.affinity[key]; n != nil {
+			for _, c := range withModel {
+				if c == n {
+					return n
+				}
+			}
+		}
+	}
+
+	cands := withModel
+	if len(warm) > 0 {
+		cands = warm
+	}
+	p.next++
+	var best *ollamaNode
+	for i := range cands {
+		n := cands[(p.next+i)%len(cands)]
+		if best == nil || n.inflight.Load() < best.inflight.Load() {
+			best = n
+		}
+	}
+	if key != "" {
+		if len(p.affinity) >= maxAffinity {
+			p.affinity = make(map[string]*ollamaNode)
+		}
+		p.affinity[key] = best
+	}
+	return best
+}
+
+// failover reports whether a request that failed with err may be retried on
+// another node.
+func failover(err error) bool {
+	if errors.Is(err, ErrBackendSaturated) {
+		return true
+	}
+	switch ErrorKind(err) {
+	case ErrUpstreamUnavailable, ErrModelNotFound:
+		return true
+	}
+	return false
+}
+
+// do runs fn on the best node, moving on to the next one while fn fails in a
+// way another node might not.
+func (p *OllamaPool) do(ctx context.Context, model string, fn func(*OllamaProvider) error) error {
+	tried := make(map[*ollamaNode]bool)
+	err := errNoOllamaNodes
+	for {
+		n := p.pick(ctx, model, tried)
+		if n == nil {
+			return err
+		}
+		tried[n] = true
+		n.inflight.Add(1)
+		err = fn(n.provider(model))
+		n.inflight.Add(-1)
+		p.record(n, err)
+		if err == nil || !failover(err) || ctx.Err() != nil {
+			return err
+		}
+		if ErrorKind(err) == ErrModelNotFound {
+			n.forget(model)
+		}
+	}
+}
+
+// OllamaPoolProvider is the Provider of one model over an OllamaPool.
+type OllamaPoolProvider struct {
+	Pool  *OllamaPool
+	Model string
+}
+
+func (pp *OllamaPoolProvider) Chat(ctx context.Context, in ChatRequest) (ChatResponse, error) {
+	var resp ChatResponse
+	err := pp.Pool.do(ctx, pp.Model, func(np *OllamaProvider) error {
+		var err error
+		resp, err = np.Chat(ctx, in)
+		return err
+	})
+	return resp, err
+}
+
+// StreamChat fails over to another node only while nothing was streamed.
+func (pp *OllamaPoolProvider) StreamChat(ctx context.Context, in ChatRequest) iter.Seq2[Chunk, error] {
+	return func(yield func(Chunk, error) bool) {
+		p := pp.Pool
+		tried := make(map[*ollamaNode]bool)
+		err := errNoOllamaNodes
+		for {
+			n := p.pick(ctx, pp.Model, tried)
+			if n == nil {
+				yield(Chunk{}, err)
+				return
+			}
+			tried[n] = true
+
+			var started, stopped bool
+			n.inflight.Add(1)
+			err = nil
+			for c, cerr := range n.provider(pp.Model).StreamChat(ctx, in) {
+				if cerr != nil {
+					err = cerr
+					break
+				}
+				started = true
+				if !yield(c, nil) {
+					stopped = true
+					break
+				}
+			}
+			n.inflight.Add(-1)
+			p.record(n, err)
+			if err == nil || stopped {
+				return
+			}
+			if started || !failover(err) || ctx.Err() != nil {
+				yield(Chunk{}, err)
+				return
+			}
+			if ErrorKind(err) == ErrModelNotFound {
+				n.forget(pp.Model)
+			}
+		}
+	}
+}
+
+func (pp *OllamaPoolProvider) Embed(ctx context.Context, inputs []string) (Embeddings, error) {
+	var out Embeddings
+	err := pp.Pool.do(ctx, pp.Model, func(np *OllamaProvider) error {
+		var err error
+		out, err = np.Embed(ctx, inputs)
+		return err
+	})
+	return out, err
+}
+
+// ListModels returns the models pulled on any reachable node.
+func (pp *OllamaPoolProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	seen := make(map[string]bool)
+	var out []ModelInfo
+	var firstErr error
+	ok := false
+	for _, n := range pp.Pool.nodes {
+		models, err := n.provider("").ListModels(ctx)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		ok = true
+		for _, m := range models {
+			if !seen[m.ID] {
+				seen[m.ID] = true
+				out = append(out, m)
+			}
+		}
+	}
+	if !ok {
+		if firstErr == nil {
+			firstErr = errNoOllamaNodes
+		}
+		return nil, firstErr
+	}
+	return out, nil
+}
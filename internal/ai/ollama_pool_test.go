@@ -0,0 +1,158 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeOllamaNode answers chat with its name, or 503 while down is set.
+type fakeOllamaNode struct {
+	name   string
+	models []string
+	down   atomic.Bool
+	chats  atomic.Int32
+}
+
+func (f *fakeOllamaNode) serve(t testing.TB) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			var names []string
+			for _, m := range f.models {
+				names = append(names, fmt.Sprintf(`{"name":%q}`, m))
+			}
+			fmt.Fprintf(w, `{"models":[%s]}`, strings.Join(names, ","))
+		case "/api/ps":
+			fmt.Fprint(w, `{"models":[]}`)
+		case "/api/chat":
+			f.chats.Add(1)
+			if f.down.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprintf(w, `{"message":{"role":"assistant","content":%q},"done":true}`, f.name)
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestPool(t *testing.T, nodes ...*fakeOllamaNode) *OllamaPool {
+	var urls []string
+	for _, n := range nodes {
+		urls = append(urls, n.serve(t).URL)
+	}
+	pool := NewOllamaPool(urls, 1, 0)
+	for _, n := range pool.nodes {
+		n.refresh(context.Background())
+	}
+	return pool
+}
+
+func chatOn(t *testing.T, p Provider, key string) (string, error) {
+	t.Helper()
+	resp, err := p.Chat(WithAffinity(context.Background(), key), ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}})
+	return resp.Content, err
+}
+
+func TestOllamaPool_SessionAffinity(t *testing.T) {
+	a := &fakeOllamaNode{name: "a", models: []string{"llama3:latest"}}
+	b := &fakeOllamaNode{name: "b", models: []string{"llama3:latest"}}
+	p := newTestPool(t, a, b).Provider("llama3")
+
+	first, err := chatOn(t, p, "s1")
+	if err != nil {
+		t.Fatalf("chat: %v", err)
+	}
+	for range 3 {
+		if got, _ := chatOn(t, p, "s1"); got != first {
+			t.Fatalf("expected session to stay on %s, got %s", first, got)
+		}
+	}
+	if other, _ := chatOn(t, p, "s2"); other == first {
+		t.Fatalf("expected an idle pool to spread new sessions, both on %s", first)
+	}
+}
+
+func TestOllamaPool_RoutesByModelAvailability(t *testing.T) {
+	a := &fakeOllamaNode{name: "a", models: []string{"llama3:latest"}}
+	b := &fakeOllamaNode{name: "b", models: []string{"llama3:latest", "mistral:7b"}}
+	p := newTestPool(t, a, b).Provider("mistral:7b")
+
+	for _, key := range []string{"s1", "s2", "s3"} {
+		if got, err := chatOn(t, p, key); err != nil || got != "b" {
+			t.Fatalf("expected node b, got %q err=%v", got, err)
+		}
+	}
+}
+
+func TestOllamaPool_FailsOverAndEjects(t *testing.T) {
+	a := &fakeOllamaNode{name: "a", models: []string{"llama3:latest"}}
+	b := &fakeOllamaNode{name: "b", models: []string{"llama3:latest"}}
+	pool := newTestPool(t, a, b)
+	p := pool.Provider("llama3")
+
+	// pin s1 to a, then take a down
+	var key string
+	for i := 0; key == ""; i++ {
+		k := fmt.Sprintf("s%d", i)
+		if got, _ := chatOn(t, p, k); got == "a" {
+			key = k
+		}
+	}
+	a.down.Store(true)
+	before := a.chats.Load()
+
+	if got, err := chatOn(t, p, key); err != nil || got != "b" {
+		t.Fatalf("expected failover to b, got %q err=%v", got, err)
+	}
+	// one failure ejects a (EjectAfter 1): new sessions skip it
+	for _, k := range []string{"x1", "x2", "x3"} {
+		if got, err := chatOn(t, p, k); err != nil || got != "b" {
+			t.Fatalf("expected b while a is ejected, got %q err=%v", got, err)
+		}
+	}
+	if n := a.chats.Load() - before; n != 1 {
+		t.Fatalf("expected a single request to the ejected node, got %d", n)
+	}
+}
+
+func TestOllamaPool_LimitKeyIgnoresTrailingSlash(t *testing.T) {
+	ls := NewLimiters(LimiterConfig{})
+	ls.SetLimit(BackendKey(NewOllamaProvider("http://gpu1:11434/", "")), LimiterConfig{MaxConcurrent: 2})
+	pool := NewOllamaPool([]string{"http://gpu1:11434/"}, 0, 0)
+	pool.UseTransports(nil, ls, nil)
+
+	lt, ok := pool.nodes[0].client.Transport.(*limiterTransport)
+	if !ok || lt.l.cfg.MaxConcurrent != 2 {
+		t.Fatalf("expected the node's own limit, got %#v", pool.nodes[0].client.Transport)
+	}
+}
+
+func TestOllamaPool_NodesBehindBreakersAndRetries(t *testing.T) {
+	a := &fakeOllamaNode{name: "a", models: []string{"llama3:latest"}}
+	pool := newTestPool(t, a)
+	bs := NewBreakers(BreakerConfig{FailureThreshold: 1, Cooldown: time.Minute})
+	pool.UseTransports(bs, nil, &RetryConfig{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	p := pool.Provider("llama3")
+
+	a.down.Store(true)
+	if _, err := chatOn(t, p, "s1"); err == nil {
+		t.Fatalf("expected the down node to fail")
+	}
+	if n := a.chats.Load(); n != 1 {
+		t.Fatalf("expected the open circuit to stop the retry, got %d requests", n)
+	}
+	st := bs.Status()
+	if len(st) != 1 || st[0].Key != BackendKey(pool.nodes[0].provider("")) || st[0].State != BreakerOpen {
+		t.Fatalf("expected the node's breaker to be open, got %+v", st)
+	}
+}
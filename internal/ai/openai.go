@@ -0,0 +1,559 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"net/http"
+	"strings"
+)
+
+// OpenAIProvider talks to any server exposing the OpenAI `/v1/chat/completions`
+// API (vLLM, llama.cpp server, LM Studio, ...). It can be registered several
+// times under different names, one per backend.
+type OpenAIProvider struct {
+	// Name is used as the prefix of error messages, e.g. "vllm: status 500".
+	Name    string
+	BaseURL string
+	APIKey  string
+	Model   string
+	// RequireAPIKey rejects requests when APIKey is empty. Local servers
+	// usually don't need a key, hosted ones do.
+	RequireAPIKey bool
+	// Headers are sent on every request in addition to the defaults.
+	Headers map[string]string
+	Client  *http.Client
+}
+
+type openAIMsg struct {
+	Role       string           `json:"role"`
+	Content    openAIContent    `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+	openAIReasoning
+}
+
+// openAIReasoning is the thinking of reasoning models in replies: OpenRouter
+// sends "reasoning", vLLM and DeepSeek send "reasoning_content".
+type openAIReasoning struct {
+	Reasoning        string `json:"reasoning,omitempty"`
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+}
+
+func (r openAIReasoning) text() string {
+	if r.Reasoning != "" {
+		return r.Reasoning
+	}
+	return r.ReasoningContent
+}
+
+// openAIContent is a plain string, or a list of parts when images are attached.
+type openAIContent struct {
+	Text  string
+	Parts []openAIPart
+}
+
+type openAIPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+}
+
+type openAIImageURL struct {
+	// URL may be a data: URL carrying the base64 image.
+	URL string `json:"url"`
+}
+
+func (c openAIContent) MarshalJSON() ([]byte, error) {
+	if c.Parts == nil {
+		return json.Marshal(c.Text)
+	}
+	return json.Marshal(c.Parts)
+}
+
+func (c *openAIContent) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(b, &c.Text); err == nil {
+		return nil
+	}
+	if err := json.Unmarshal(b, &c.Parts); err != nil {
+		return err
+	}
+	for _, p := range c.Parts {
+		c.Text += p.Text
+	}
+	return nil
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name string `json:"name"`
+		// Arguments is a JSON-encoded string on the wire.
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type openAITool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description,omitempty"`
+		Parameters  json.RawMessage `json:"parameters,omitempty"`
+	} `json:"function"`
+}
+
+type openAIChatReq struct {
+	Model         string               `json:"model"`
+	Messages      []openAIMsg          `json:"messages"`
+	Tools         []openAITool         `json:"tools,omitempty"`
+	Stream        bool                 `json:"stream"`
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+	Temperature   *float64             `json:"temperature,omitempty"`
+	TopP          *float64             `json:"top_p,omitempty"`
+	MaxTokens     *int                 `json:"max_tokens,omitempty"`
+	Stop          []string             `json:"stop,omitempty"`
+	Seed          *int                 `json:"seed,omitempty"`
+	// ResponseFormat is not supported by every OpenAI-compatible server; the
+	// reply is validated by the caller regardless.
+	ResponseFormat *openAIResponseFormat `json:"response_format,omitempty"`
+}
+
+type openAIResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *openAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+type openAIJSONSchema struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+}
+
+func toOpenAIResponseFormat(f *ResponseFormat) *openAIResponseFormat {
+	switch {
+	case f == nil:
+		return nil
+	case f.Type == FormatJSONSchema:
+		return &openAIResponseFormat{Type: "json_schema", JSONSchema: &openAIJSONSchema{Name: f.schemaName(), Schema: f.Schema}}
+	default:
+		return &openAIResponseFormat{Type: "json_object"}
+	}
+}
+
+func newOpenAIChatReq(model string, in ChatRequest, stream bool) openAIChatReq {
+	req := openAIChatReq{
+		Model:       model,
+		Messages:    toOpenAIMsgs(in.Messages),
+		Stream:      stream,
+		Temperature: in.Options.Temperature,
+		TopP:        in.Options.TopP,
+		MaxTokens:   in.Options.MaxTokens,
+		Stop:        in.Options.Stop,
+		Seed:        in.Options.Seed,
+
+		ResponseFormat: toOpenAIResponseFormat(in.ResponseFormat),
+	}
+	if stream {
+		req.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	} else {
+		req.Tools = toOpenAITools(in.Tools)
+	}
+	return req
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+type openAIError struct {
+	Message string `json:"message"`
+	// Code is an HTTP status on OpenRouter, a string elsewhere.
+	Code json.RawMessage `json:"code,omitempty"`
+}
+
+func (e *openAIError) err(provider string) error {
+	var status int
+	_ = json.Unmarshal(e.Code, &status)
+	return newBackendError(provider, status, e.Message)
+}
+
+type openAIChatResp struct {
+	Choices []struct {
+		Message openAIMsg `json:"message"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage,omitempty"`
+	Error *openAIError `json:"error,omitempty"`
+}
+
+type openAIStreamResp struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+			openAIReasoning
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	// only on the final chunk, when stream_options.include_usage is set
+	Usage *openAIUsage `json:"usage,omitempty"`
+	Error *openAIError `json:"error,omitempty"`
+}
+
+func NewOpenAIProvider(name, baseURL, apiKey, model string) *OpenAIProvider {
+	if name == "" {
+		name = "openai"
+	}
+	if baseURL == "" {
+		baseURL = "http://localhost:8000/v1"
+	}
+	return &OpenAIProvider{
+		Name:    name,
+		BaseURL: baseURL,
+		APIKey:  apiKey,
+		Model:   model,
+		Headers: map[string]string{},
+		Client:  newHTTPClient(baseURL),
+	}
+}
+
+func (p *OpenAIProvider) backendKey() string { return p.Name + "|" + p.BaseURL }
+
+func (p *OpenAIProvider) httpClient() *http.Client { return p.Client }
+
+func (p *OpenAIProvider) validate() (string, error) {
+	if p.Client == nil {
+		return "", fmt.Errorf("%s: http client is nil", p.Name)
+	}
+	if p.RequireAPIKey && strings.TrimSpace(p.APIKey) == "" {
+		return "", fmt.Errorf("%s: api key is required", p.Name)
+	}
+	model := strings.TrimSpace(p.Model)
+	if model == "" {
+		return "", fmt.Errorf("%s: model is required", p.Name)
+	}
+	return model, nil
+}
+
+func (p *OpenAIProvider) newRequest(ctx context.Context, path string, body any) (*http.Request, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	url := strings.TrimRight(p.BaseURL, "/") + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	}
+	for k, v := range p.Headers {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+func (p *OpenAIProvider) statusError(resp *http.Response) error {
+	return newStatusError(p.Name, resp, decodeErrorMessage)
+}
+
+func (u *openAIUsage) usage() Usage {
+	if u == nil {
+		return Usage{}
+	}
+	return Usage{PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens}
+}
+
+func toOpenAIMsgs(messages []Message) []openAIMsg {
+	out := make([]openAIMsg, 0, len(messages))
+	for _, m := range messages {
+		om := openAIMsg{Role: m.Role, Content: openAIContent{Text: m.Content}, ToolCallID: m.ToolCallID}
+		if len(m.Images) > 0 {
+			if m.Content != "" {
+				om.Content.Parts = append(om.Content.Parts, openAIPart{Type: "text", Text: m.Content})
+			}
+			for _, img := range m.Images {
+				om.Content.Parts = append(om.Content.Parts, openAIPart{
+					Type:     "image_url",
+					ImageURL: &openAIImageURL{URL: "data:" + img.MimeType + ";base64," + base64.StdEncoding.EncodeToString(img.Data)},
+				})
+			}
+		}
+		for _, tc := range m.ToolCalls {
+			otc := openAIToolCall{ID: tc.ID, Type: "function"}
+			otc.Function.Name = tc.Name
+			otc.Function.Arguments = string(toolArgs(tc.Arguments))
+			om.ToolCalls = append(om.ToolCalls, otc)
+		}
+		out = append(out, om)
+	}
+	return out
+}
+
+func toOpenAITools(tools []Tool) []openAITool {
+	out := make([]openAITool, 0, len(tools))
+	for _, t := range tools {
+		ot := openAITool{Type: "function"}
+		ot.Function.Name = t.Name
+		ot.Function.Description = t.Description
+		ot.Function.Parameters = t.Parameters
+		out = append(out, ot)
+	}
+	return out
+}
+
+func fromOpenAIToolCalls(calls []openAIToolCall) []ToolCall {
+	var out []ToolCall
+	for _, c := range calls {
+		args := json.RawMessage(c.Function.Arguments)
+		if !json.Valid(args) {
+			// some servers send arguments that aren't valid JSON; keep them as a string
+			args, _ = json.Marshal(c.Function.Arguments)
+		}
+		id := c.ID
+		if id == "" {
+			id = newToolCallID()
+		}
+		out = append(out, ToolCall{ID: id, Name: c.Function.Name, Arguments: toolArgs(args)})
+	}
+	return out
+}
+
+func (p *OpenAIProvider) Chat(ctx context.Context, in ChatRequest) (ChatResponse, error) {
+	model, err := p.validate()
+	if err != nil {
+		return ChatResponse{}, err
+	}
+
+	req, err := p.newRequest(ctx, "/chat/completions", newOpenAIChatReq(model, in, false))
+	if err != nil {
+		return ChatResponse{}, err
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return ChatResponse{}, p.statusError(resp)
+	}
+
+	var decoded openAIChatResp
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return ChatResponse{}, err
+	}
+	if decoded.Error != nil && decoded.Error.Message != "" {
+		return ChatResponse{}, decoded.Error.err(p.Name)
+	}
+	if len(decoded.Choices) == 0 {
+		return ChatResponse{}, fmt.Errorf("%s: empty response", p.Name)
+	}
+	msg := decoded.Choices[0].Message
+	return ChatResponse{
+		Content:   msg.Content.Text,
+		Reasoning: msg.text(),
+		ToolCalls: fromOpenAIToolCalls(msg.ToolCalls),
+		Usage:     decoded.Usage.usage(),
+	}, nil
+}
+
+// StreamChat streams assistant content chunks via SSE.
+func (p *OpenAIProvider) StreamChat(ctx context.Context, in ChatRequest) iter.Seq2[Chunk, error] {
+	return func(yield func(Chunk, error) bool) {
+		model, err := p.validate()
+		if err != nil {
+			yield(Chunk{}, err)
+			return
+		}
+
+		req, err := p.newRequest(ctx, "/chat/completions", newOpenAIChatReq(model, in, true))
+		if err != nil {
+			yield(Chunk{}, err)
+			return
+		}
+
+		resp, err := streamClient(p.Client).Do(req)
+		if err != nil {
+			yield(Chunk{}, err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			yield(Chunk{}, p.statusError(resp))
+			return
+		}
+
+		sc := bufio.NewScanner(resp.Body)
+		buf := make([]byte, 0, 64*1024)
+		sc.Buffer(buf, 2*1024*1024)
+
+		// usage arrives in its own chunk after the finish reason
+		var usage Usage
+		var finish string
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" || !strings.HasPrefix(line, "data:") {
+				continue
+			}
+			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			if data == "[DONE]" {
+				yield(finalChunk(finish, usage), nil)
+				return
+			}
+			var decoded openAIStreamResp
+			if err := json.Unmarshal([]byte(data), &decoded); err != nil {
+				yield(Chunk{}, err)
+				return
+			}
+			if decoded.Error != nil && decoded.Error.Message != "" {
+				yield(Chunk{}, decoded.Error.err(p.Name))
+				return
+			}
+			if decoded.Usage != nil {
+				usage = decoded.Usage.usage()
+			}
+			if len(decoded.Choices) == 0 {
+				continue
+			}
+			choice := decoded.Choices[0]
+			if choice.FinishReason != nil {
+				finish = *choice.FinishReason
+			}
+			delta := choice.Delta
+			if delta.Content != "" || delta.text() != "" {
+				if !yield(Chunk{Delta: delta.Content, Reasoning: delta.text()}, nil) {
+					return
+				}
+			}
+		}
+
+		if err := sc.Err(); err != nil {
+			yield(Chunk{}, err)
+			return
+		}
+		// some servers close the stream without [DONE]
+		yield(finalChunk(finish, usage), nil)
+	}
+}
+
+// openAIModelsResp is the /models listing. OpenRouter adds context length,
+// modalities and pricing; plain OpenAI-compatible servers only send ids.
+type openAIModelsResp struct {
+	Data []struct {
+		ID            string `json:"id"`
+		Name          string `json:"name"`
+		ContextLength int    `json:"context_length"`
+		Architecture  *struct {
+			InputModalities []string `json:"input_modalities"`
+		} `json:"architecture"`
+		Pricing *ModelPricing `json:"pricing"`
+	} `json:"data"`
+}
+
+// ListModels returns the models served at /models.
+func (p *OpenAIProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	if p.Client == nil {
+		return nil, fmt.Errorf("%s: http client is nil", p.Name)
+	}
+	url := fmt.Sprintf("%s/models", strings.TrimRight(p.BaseURL, "/"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	}
+	for k, v := range p.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, p.statusError(resp)
+	}
+
+	var decoded openAIModelsResp
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return nil, err
+	}
+	models := make([]ModelInfo, 0, len(decoded.Data))
+	for _, m := range decoded.Data {
+		mi := ModelInfo{ID: m.ID, Name: m.Name, ContextLength: m.ContextLength, Pricing: m.Pricing}
+		if m.Architecture != nil {
+			mi.InputModalities = m.Architecture.InputModalities
+		}
+		models = append(models, mi)
+	}
+	return models, nil
+}
+
+type openAIEmbedReq struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type openAIEmbedResp struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Usage *openAIUsage `json:"usage,omitempty"`
+	Error *openAIError `json:"error,omitempty"`
+}
+
+// Embed uses /embeddings. Vectors are put back in input order by index.
+func (p *OpenAIProvider) Embed(ctx context.Context, inputs []string) (Embeddings, error) {
+	model, err := p.validate()
+	if err != nil {
+		return Embeddings{}, err
+	}
+	return embedBatches(ctx, p.Name, inputs, func(ctx context.Context, batch []string) (Embeddings, error) {
+		req, err := p.newRequest(ctx, "/embeddings", openAIEmbedReq{Model: model, Input: batch})
+		if err != nil {
+			return Embeddings{}, err
+		}
+		resp, err := p.Client.Do(req)
+		if err != nil {
+			return Embeddings{}, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return Embeddings{}, p.statusError(resp)
+		}
+
+		var decoded openAIEmbedResp
+		if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+			return Embeddings{}, err
+		}
+		if decoded.Error != nil && decoded.Error.Message != "" {
+			return Embeddings{}, decoded.Error.err(p.Name)
+		}
+		vectors := make([][]float32, len(batch))
+		for _, d := range decoded.Data {
+			if d.Index < 0 || d.Index >= len(vectors) {
+				return Embeddings{}, fmt.Errorf("%s: embedding index %d out of range", p.Name, d.Index)
+			}
+			vectors[d.Index] = d.Embedding
+		}
+		return Embeddings{Vectors: vectors, Usage: decoded.Usage.usage()}, nil
+	})
+}
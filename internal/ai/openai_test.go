@@ -0,0 +1,68 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOpenAIProvider_StreamSeparatesReasoning(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"reasoning\":\"let me \"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"reasoning_content\":\"think\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"42\"}}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	p := NewOpenAIProvider("test", srv.URL, "", "m")
+	var answer, reasoning string
+	for c, err := range p.StreamChat(context.Background(), ChatRequest{Messages: []Message{{Role: "user", Content: "?"}}}) {
+		if err != nil {
+			t.Fatalf("stream: %v", err)
+		}
+		answer += c.Delta
+		reasoning += c.Reasoning
+	}
+	if answer != "42" || reasoning != "let me think" {
+		t.Fatalf("expected answer %q and reasoning %q, got %q and %q", "42", "let me think", answer, reasoning)
+	}
+}
+
+func TestOpenAIProvider_StreamReleasesConnectionOnBreak(t *testing.T) {
+	closed := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(closed)
+		for {
+			fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"x\"}}]}\n\n")
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}))
+	defer srv.Close()
+
+	p := NewOpenAIProvider("test", srv.URL, "", "m")
+	p.Client.Timeout = time.Second
+	for _, err := range p.StreamChat(context.Background(), ChatRequest{}) {
+		if err != nil {
+			t.Fatalf("stream: %v", err)
+		}
+		break
+	}
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("connection not released after the consumer stopped")
+	}
+	if p.Client.Timeout != time.Second {
+		t.Fatalf("stream must not change the shared client timeout")
+	}
+}
@@ -1,12 +1,145 @@
 package ai
 
-import "context"
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+)
 
+// Message is one chat turn. Its parts are the text Content followed by Images.
 type Message struct {
 	Role    string
 	Content string
+	// Images are attached to user messages for vision models.
+	Images []Image
+	// ToolCalls are the calls requested by an assistant message.
+	ToolCalls []ToolCall
+	// ToolCallID links a "tool" message to the call it answers.
+	ToolCallID string
+	// Name is the tool name on "tool" messages.
+	Name string
+}
+
+// Image is an inline image part of a message.
+type Image struct {
+	MimeType string
+	Data     []byte
+}
+
+// Tool describes a function the model may call.
+type Tool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Parameters is a JSON Schema object describing the arguments.
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ToolCall is a model's request to invoke a tool. Arguments is a JSON object.
+type ToolCall struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type ChatRequest struct {
+	Messages []Message
+	// Tools the model may call; empty means plain chat.
+	Tools   []Tool
+	Options GenerationOptions
+	// ResponseFormat requests JSON output; nil means free text.
+	ResponseFormat *ResponseFormat
+}
+
+// GenerationOptions tune sampling. Unset fields are left to the backend's defaults.
+type GenerationOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	MaxTokens   *int     `json:"max_tokens,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Seed        *int     `json:"seed,omitempty"`
+	// NumCtx is Ollama's context window size; other backends ignore it.
+	NumCtx *int `json:"num_ctx,omitempty"`
+}
+
+// Merge returns o with every field set in override replacing its own.
+func (o GenerationOptions) Merge(override *GenerationOptions) GenerationOptions {
+	if override == nil {
+		return o
+	}
+	if override.Temperature != nil {
+		o.Temperature = override.Temperature
+	}
+	if override.TopP != nil {
+		o.TopP = override.TopP
+	}
+	if override.MaxTokens != nil {
+		o.MaxTokens = override.MaxTokens
+	}
+	if override.Stop != nil {
+		o.Stop = override.Stop
+	}
+	if override.Seed != nil {
+		o.Seed = override.Seed
+	}
+	if override.NumCtx != nil {
+		o.NumCtx = override.NumCtx
+	}
+	return o
+}
+
+// Validate rejects values no backend accepts.
+func (o GenerationOptions) Validate() error {
+	if o.Temperature != nil && (*o.Temperature < 0 || *o.Temperature > 2) {
+		return errors.New("temperature must be between 0 and 2")
+	}
+	if o.TopP != nil && (*o.TopP <= 0 || *o.TopP > 1) {
+		return errors.New("top_p must be in (0, 1]")
+	}
+	if o.MaxTokens != nil && *o.MaxTokens <= 0 {
+		return errors.New("max_tokens must be positive")
+	}
+	if len(o.Stop) > 8 {
+		return errors.New("at most 8 stop sequences")
+	}
+	if o.NumCtx != nil && *o.NumCtx <= 0 {
+		return errors.New("num_ctx must be positive")
+	}
+	return nil
+}
+
+// Usage is the token accounting reported by the backend; zero when unknown.
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
+type ChatResponse struct {
+	Content string
+	// Reasoning is the model's thinking, if the backend reports it separately.
+	Reasoning string
+	ToolCalls []ToolCall
+	Usage     Usage
+	// Backend is set by composite providers to the backend that actually answered.
+	Backend *Backend
 }
 
 type Provider interface {
-	Chat(ctx context.Context, messages []Message) (string, error)
+	Chat(ctx context.Context, req ChatRequest) (ChatResponse, error)
+}
+
+// newToolCallID is used for backends that don't assign call IDs themselves.
+func newToolCallID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return "call_" + hex.EncodeToString(b)
+}
+
+// toolArgs normalizes tool call arguments to a JSON object.
+func toolArgs(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 || string(raw) == "null" {
+		return json.RawMessage("{}")
+	}
+	return raw
 }
@@ -3,35 +3,250 @@ package ai
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"sort"
 	"strings"
 	"sync"
 )
 
 type ProviderFactory func(ctx context.Context, model string) (Provider, error)
 
+// Registry builds providers by name and caches them per provider, model and
+// config key, so requests share a provider and its keep-alive connections.
+// Providers must be safe for concurrent use.
 type Registry struct {
 	mu        sync.RWMutex
 	factories map[string]ProviderFactory
+	// configKeys holds the key each factory was registered with
+	configKeys map[string]string
+	// allowed restricts the models of a provider; nil allows any
+	allowed  map[string][]string
+	breakers *Breakers
+	limiters *Limiters
+	retry    *RetryConfig
+
+	cacheMu sync.Mutex
+	cache   map[string]Provider
+	// gen counts config changes; a provider built before one isn't cached
+	gen uint64
+}
+
+// httpBackend is implemented by the HTTP adapters so the registry can wrap
+// their transport.
+type httpBackend interface {
+	// backendKey identifies the backend, e.g. "ollama|http://localhost:11434".
+	backendKey() string
+	httpClient() *http.Client
+}
+
+// BackendKey returns the key breakers and limiters know p's backend by, or
+// "" when p is not an HTTP backend.
+func BackendKey(p Provider) string {
+	if hb, ok := p.(httpBackend); ok {
+		return hb.backendKey()
+	}
+	return ""
+}
+
+// UseBreakers puts every provider returned by Get behind a circuit breaker.
+func (r *Registry) UseBreakers(bs *Breakers) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.breakers = bs
+	r.Invalidate()
+}
+
+// UseLimiters bounds the concurrent requests to each backend of the providers
+// returned by Get. The limiter sits in front of the circuit breaker and
+// behind retries, so a retry waits for a slot again.
+func (r *Registry) UseLimiters(ls *Limiters) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limiters = ls
+	r.Invalidate()
 }
 
 func NewRegistry() *Registry {
-	return &Registry{factories: make(map[string]ProviderFactory)}
+	return &Registry{
+		factories:  make(map[string]ProviderFactory),
+		configKeys: make(map[string]string),
+		allowed:    make(map[string][]string),
+		cache:      make(map[string]Provider),
+	}
 }
 
+// Register adds a provider factory under name. Registering a name again
+// drops every cached provider.
 func (r *Registry) Register(name string, f ProviderFactory) {
+	r.RegisterConfig(name, "", f)
+}
+
+// RegisterConfig is Register for a factory whose providers depend only on
+// configKey, e.g. a digest of the backend's settings. Registering the name
+// again with the same non-empty key keeps the cached providers; a new key
+// means the config changed and drops them.
+func (r *Registry) RegisterConfig(name, configKey string, f ProviderFactory) {
 	name = strings.ToLower(strings.TrimSpace(name))
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	old, registered := r.configKeys[name]
 	r.factories[name] = f
+	r.configKeys[name] = configKey
+	// a provider may wrap others from the registry, e.g. replay or a chain,
+	// so a change drops the whole cache rather than just this name's entries
+	if registered && (configKey == "" || configKey != old) {
+		r.Invalidate()
+	}
+}
+
+// Unregister removes the provider registered under name and drops every
+// cached provider.
+func (r *Registry) Unregister(name string) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.factories[name]; !ok {
+		return
+	}
+	delete(r.factories, name)
+	delete(r.configKeys, name)
+	delete(r.allowed, name)
+	r.Invalidate()
+}
+
+// AllowModels restricts the models Get serves for name; an empty list
+// allows any model. The provider's default model, asked for as "", is always
+// served.
+func (r *Registry) AllowModels(name string, models []string) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(models) == 0 {
+		delete(r.allowed, name)
+		return
+	}
+	r.allowed[name] = append([]string(nil), models...)
+}
+
+// Allowed reports whether name may serve model.
+func (r *Registry) Allowed(name, model string) bool {
+	name = strings.ToLower(strings.TrimSpace(name))
+	model = strings.TrimSpace(model)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return allowedModel(r.allowed[name], model)
+}
+
+func allowedModel(allowed []string, model string) bool {
+	if len(allowed) == 0 || model == "" {
+		return true
+	}
+	for _, m := range allowed {
+		// ollama resolves an untagged name to :latest
+		if m == model || m == model+":latest" || m+":latest" == model {
+			return true
+		}
+	}
+	return false
 }
 
+// Invalidate drops every cached provider; the next Get builds them afresh.
+func (r *Registry) Invalidate() {
+	r.cacheMu.Lock()
+	defer r.cacheMu.Unlock()
+	r.gen++
+	clear(r.cache)
+}
+
+// Has reports whether a provider is registered under name.
+func (r *Registry) Has(name string) bool {
+	name = strings.ToLower(strings.TrimSpace(name))
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.factories[name]
+	return ok
+}
+
+// Names returns the registered provider names, sorted.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	r.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// UseRetry retries transient failures of every provider returned by Get.
+// Retries sit in front of the circuit breaker, so an open circuit is not retried.
+func (r *Registry) UseRetry(cfg RetryConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.retry = &cfg
+	r.Invalidate()
+}
+
+// Get returns the provider of name for model, building it on first use.
+// Factory errors are not cached.
 func (r *Registry) Get(ctx context.Context, name string, model string) (Provider, error) {
 	name = strings.ToLower(strings.TrimSpace(name))
+	model = strings.TrimSpace(model)
 	r.mu.RLock()
 	f, ok := r.factories[name]
+	allowed := allowedModel(r.allowed[name], model)
+	key := name + "|" + r.configKeys[name] + "|" + model
+	bs, ls, retry := r.breakers, r.limiters, r.retry
+	r.cacheMu.Lock()
+	p, cached := r.cache[key]
+	gen := r.gen
+	r.cacheMu.Unlock()
 	r.mu.RUnlock()
 	if !ok {
 		return nil, fmt.Errorf("unknown ai provider: %s", name)
 	}
-	return f(ctx, model)
+	if !allowed {
+		return nil, fmt.Errorf("%w: %s:%s", ErrUnknownModel, name, model)
+	}
+	if cached {
+		return p, nil
+	}
+
+	// built outside the lock: factories may call Get themselves
+	p, err := f(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+	if hb, ok := p.(httpBackend); ok {
+		if c := hb.httpClient(); c != nil {
+			wrapClient(c, hb.backendKey(), bs, ls, retry)
+		}
+	}
+
+	r.cacheMu.Lock()
+	defer r.cacheMu.Unlock()
+	if cached, ok := r.cache[key]; ok {
+		// another request built it first
+		return cached, nil
+	}
+	if gen == r.gen {
+		r.cache[key] = p
+	}
+	return p, nil
+}
+
+// wrapClient puts c behind the circuit breaker and limiter of the backend
+// key, then the retries, so a retry waits for a slot and skips an open
+// circuit. Nil ones are left out.
+func wrapClient(c *http.Client, key string, bs *Breakers, ls *Limiters, retry *RetryConfig) {
+	if bs != nil {
+		c.Transport = bs.Transport(key, c.Transport)
+	}
+	if ls != nil {
+		c.Transport = ls.Transport(key, c.Transport)
+	}
+	if retry != nil {
+		c.Transport = NewRetryTransport(*retry, c.Transport)
+	}
 }
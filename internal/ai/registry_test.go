@@ -0,0 +1,110 @@
+package ai
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRegistry_CachesProvidersPerConfig(t *testing.T) {
+	var built atomic.Int32
+	factory := func(ctx context.Context, model string) (Provider, error) {
+		built.Add(1)
+		return NewOllamaProvider("http://ollama.test", model), nil
+	}
+	reg := NewRegistry()
+	reg.RegisterConfig("ollama", "v1", factory)
+	ctx := context.Background()
+
+	a, _ := reg.Get(ctx, "ollama", "llama3")
+	b, _ := reg.Get(ctx, "OLLAMA", " llama3 ")
+	if a != b || built.Load() != 1 {
+		t.Fatalf("expected one cached provider, built %d", built.Load())
+	}
+	if c, _ := reg.Get(ctx, "ollama", "qwen3"); c == a {
+		t.Fatalf("expected a provider per model")
+	}
+
+	// the same config keeps the cache, a new one drops it
+	reg.RegisterConfig("ollama", "v1", factory)
+	if c, _ := reg.Get(ctx, "ollama", "llama3"); c != a {
+		t.Fatalf("expected an unchanged config to keep the provider")
+	}
+	reg.RegisterConfig("ollama", "v2", factory)
+	if c, _ := reg.Get(ctx, "ollama", "llama3"); c == a {
+		t.Fatalf("expected a config change to rebuild the provider")
+	}
+	if built.Load() != 3 {
+		t.Fatalf("expected 3 builds, got %d", built.Load())
+	}
+}
+
+// BenchmarkRegistry_ConnectionReuse sends bursts of concurrent chats the old
+// way, with a provider and client per request on Go's default transport, and
+// through the registry's cached providers. An op is one burst; new-conns/op
+// counts the connections it had to dial. The default transport keeps only 2
+// idle connections per host, so each burst redials most of them.
+func BenchmarkRegistry_ConnectionReuse(b *testing.B) {
+	run := func(b *testing.B, setup func(baseURL string) func(ctx context.Context) Provider) {
+		srv := (&fakeOllamaNode{name: "n"}).serve(b)
+		next := srv.Config.Handler
+		srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(time.Millisecond) // a model takes a while
+			next.ServeHTTP(w, r)
+		})
+		var dials atomic.Int64
+		srv.Config.ConnState = func(_ net.Conn, s http.ConnState) {
+			if s == http.StateNew {
+				dials.Add(1)
+			}
+		}
+		get := setup(srv.URL)
+		ctx := context.Background()
+		in := ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}}
+
+		const burst = 16
+		for b.Loop() {
+			var wg sync.WaitGroup
+			for range burst {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := get(ctx).Chat(ctx, in); err != nil {
+						b.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+		}
+		b.ReportMetric(float64(dials.Load())/float64(b.N), "new-conns/op")
+	}
+
+	b.Run("provider-per-request", func(b *testing.B) {
+		run(b, func(baseURL string) func(ctx context.Context) Provider {
+			return func(ctx context.Context) Provider {
+				p := NewOllamaProvider(baseURL, "llama3")
+				p.Client = &http.Client{Timeout: 90 * time.Second}
+				return p
+			}
+		})
+	})
+	b.Run("registry", func(b *testing.B) {
+		run(b, func(baseURL string) func(ctx context.Context) Provider {
+			reg := NewRegistry()
+			reg.Register("ollama", func(ctx context.Context, model string) (Provider, error) {
+				return NewOllamaProvider(baseURL, model), nil
+			})
+			return func(ctx context.Context) Provider {
+				p, err := reg.Get(ctx, "ollama", "llama3")
+				if err != nil {
+					b.Fatal(err)
+				}
+				return p
+			}
+		})
+	})
+}
@@ -0,0 +1,208 @@
+package ai
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	ReplayModeRecord = "record"
+	ReplayModeReplay = "replay"
+)
+
+// ErrNoCassette is returned in replay mode when no cassette matches a request.
+var ErrNoCassette = errors.New("replay: no cassette for request")
+
+// ReplayProvider serves chat replies from cassettes on disk. In record mode
+// it proxies to Upstream and writes a cassette per successful request; in
+// replay mode it only reads them, so tests and demos run without a backend.
+// Failed upstream calls are not recorded.
+type ReplayProvider struct {
+	Mode string
+	Dir  string
+	// Model is part of the cassette key, so recordings of different models
+	// don't collide.
+	Model string
+	// Upstream is only used in record mode.
+	Upstream Provider
+}
+
+// cassette is one recorded request. Request is kept for readability only;
+// lookups go by the file name.
+type cassette struct {
+	Request  ChatRequest     `json:"request"`
+	Response *ChatResponse   `json:"response,omitempty"`
+	Stream   []cassetteChunk `json:"stream,omitempty"`
+}
+
+type cassetteChunk struct {
+	Delta     string `json:"delta,omitempty"`
+	Reasoning string `json:"reasoning,omitempty"`
+	Usage     *Usage `json:"usage,omitempty"`
+
+	FinishReason string `json:"finish_reason,omitempty"`
+	// DelayMS is the time since the previous chunk.
+	DelayMS int64 `json:"delay_ms"`
+}
+
+func NewReplayProvider(mode, dir, model string, upstream Provider) (*ReplayProvider, error) {
+	switch mode {
+	case ReplayModeReplay:
+	case ReplayModeRecord:
+		if upstream == nil {
+			return nil, errors.New("replay: record mode needs an upstream provider")
+		}
+	default:
+		return nil, fmt.Errorf("replay: unknown mode %q", mode)
+	}
+	return &ReplayProvider{Mode: mode, Dir: dir, Model: model, Upstream: upstream}, nil
+}
+
+// path returns the cassette file of a request. Streamed and plain requests
+// are recorded separately.
+func (p *ReplayProvider) path(kind string, req ChatRequest) (string, error) {
+	b, err := json.Marshal(struct {
+		Kind    string
+		Model   string
+		Request ChatRequest
+	}{kind, p.Model, req})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return filepath.Join(p.Dir, kind+"-"+hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+func (p *ReplayProvider) load(path string) (*cassette, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNoCassette, filepath.Base(path))
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c cassette
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("replay: %s: %w", filepath.Base(path), err)
+	}
+	return &c, nil
+}
+
+func (p *ReplayProvider) save(path string, c *cassette) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(p.Dir, 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (p *ReplayProvider) Chat(ctx context.Context, in ChatRequest) (ChatResponse, error) {
+	path, err := p.path("chat", in)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	if p.Mode == ReplayModeReplay {
+		c, err := p.load(path)
+		if err != nil {
+			return ChatResponse{}, err
+		}
+		if c.Response == nil {
+			return ChatResponse{}, fmt.Errorf("replay: %s has no response", filepath.Base(path))
+		}
+		return *c.Response, nil
+	}
+
+	resp, err := p.Upstream.Chat(ctx, in)
+	if err != nil {
+		return resp, err
+	}
+	rec := resp
+	rec.Backend = nil
+	if err := p.save(path, &cassette{Request: in, Response: &rec}); err != nil {
+		return ChatResponse{}, err
+	}
+	return resp, nil
+}
+
+// StreamChat replays recorded chunks with their original timing, or records
+// the upstream stream while forwarding it. A stream the consumer stops early
+// is not recorded.
+func (p *ReplayProvider) StreamChat(ctx context.Context, in ChatRequest) iter.Seq2[Chunk, error] {
+	return func(yield func(Chunk, error) bool) {
+		path, err := p.path("stream", in)
+		if err != nil {
+			yield(Chunk{}, err)
+			return
+		}
+		if p.Mode == ReplayModeReplay {
+			p.replayStream(ctx, path, yield)
+			return
+		}
+		p.recordStream(ctx, path, in, yield)
+	}
+}
+
+func (p *ReplayProvider) replayStream(ctx context.Context, path string, yield func(Chunk, error) bool) {
+	c, err := p.load(path)
+	if err != nil {
+		yield(Chunk{}, err)
+		return
+	}
+	for _, rc := range c.Stream {
+		if rc.DelayMS > 0 {
+			t := time.NewTimer(time.Duration(rc.DelayMS) * time.Millisecond)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				yield(Chunk{}, ctx.Err())
+				return
+			case <-t.C:
+			}
+		}
+		chunk := Chunk{Delta: rc.Delta, Reasoning: rc.Reasoning, Usage: rc.Usage, FinishReason: rc.FinishReason}
+		if !yield(chunk, nil) {
+			return
+		}
+	}
+}
+
+func (p *ReplayProvider) recordStream(ctx context.Context, path string, in ChatRequest, yield func(Chunk, error) bool) {
+	sp, ok := p.Upstream.(StreamProvider)
+	if !ok {
+		yield(Chunk{}, errors.New("replay: upstream does not support streaming"))
+		return
+	}
+
+	rec := &cassette{Request: in}
+	last := time.Now()
+	for c, err := range sp.StreamChat(ctx, in) {
+		if err != nil {
+			yield(Chunk{}, err)
+			return
+		}
+		now := time.Now()
+		rec.Stream = append(rec.Stream, cassetteChunk{Delta: c.Delta, Reasoning: c.Reasoning, Usage: c.Usage, FinishReason: c.FinishReason, DelayMS: now.Sub(last).Milliseconds()})
+		last = now
+		if !yield(c, nil) {
+			return
+		}
+	}
+	if err := p.save(path, rec); err != nil {
+		yield(Chunk{}, err)
+	}
+}
@@ -0,0 +1,55 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestReplayProvider_RecordThenReplay(t *testing.T) {
+	dir := t.TempDir()
+	up := &stubProvider{reply: "recorded"}
+	req := ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}}
+
+	rec, err := NewReplayProvider(ReplayModeRecord, dir, "m", up)
+	if err != nil {
+		t.Fatalf("new recorder: %v", err)
+	}
+	if _, err := rec.Chat(context.Background(), req); err != nil {
+		t.Fatalf("record chat: %v", err)
+	}
+	for _, err := range rec.StreamChat(context.Background(), req) {
+		if err != nil {
+			t.Fatalf("record stream: %v", err)
+		}
+	}
+
+	// the upstream is gone in replay mode
+	rp, err := NewReplayProvider(ReplayModeReplay, dir, "m", nil)
+	if err != nil {
+		t.Fatalf("new replayer: %v", err)
+	}
+	resp, err := rp.Chat(context.Background(), req)
+	if err != nil || resp.Content != "recorded" {
+		t.Fatalf("replay chat: %+v %v", resp, err)
+	}
+	var got, finish string
+	for c, err := range rp.StreamChat(context.Background(), req) {
+		if err != nil {
+			t.Fatalf("replay stream: %v", err)
+		}
+		got += c.Delta
+		finish = c.FinishReason
+	}
+	if got != "recorded" || finish != FinishStop {
+		t.Fatalf("replay stream: %q (finish %q)", got, finish)
+	}
+	if up.calls != 2 {
+		t.Fatalf("expected 2 upstream calls, got %d", up.calls)
+	}
+
+	other := ChatRequest{Messages: []Message{{Role: "user", Content: "bye"}}}
+	if _, err := rp.Chat(context.Background(), other); !errors.Is(err, ErrNoCassette) {
+		t.Fatalf("expected ErrNoCassette, got %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package ai
+
+import (
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryConfig controls transport-level retries of backend calls. These only
+// cover a single HTTP exchange; the worker's queue retries are separate.
+type RetryConfig struct {
+	// MaxAttempts includes the first try.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	// MaxDelay caps the backoff; a Retry-After longer than this is not waited
+	// out and the response is returned to the caller instead.
+	MaxDelay time.Duration
+}
+
+// NewRetryTransport retries requests that failed before the backend started
+// answering: 429/502/503/504 responses and refused or reset connections.
+// Once a 2xx response is returned its body is the caller's, so streams are
+// never retried midway.
+func NewRetryTransport(cfg RetryConfig, next http.RoundTripper) http.RoundTripper {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 3
+	}
+	if cfg.BaseDelay <= 0 {
+		cfg.BaseDelay = 200 * time.Millisecond
+	}
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = 5 * time.Second
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &retryTransport{cfg: cfg, next: next, now: time.Now}
+}
+
+type retryTransport struct {
+	cfg  RetryConfig
+	next http.RoundTripper
+	now  func() time.Time
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if attempt >= t.cfg.MaxAttempts || ctx.Err() != nil || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+
+		var wait time.Duration
+		switch {
+		case err != nil:
+			if !retryableNetError(err) {
+				return resp, err
+			}
+			wait = t.backoff(attempt)
+		case retryableStatus(resp.StatusCode):
+			wait = t.backoff(attempt)
+			if ra, ok := retryAfter(resp.Header.Get("Retry-After"), t.now()); ok {
+				if ra > t.cfg.MaxDelay {
+					return resp, nil
+				}
+				wait = max(wait, ra)
+			}
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4*1024))
+			resp.Body.Close()
+		default:
+			return resp, nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+	}
+}
+
+// backoff is "full jitter": a random delay up to BaseDelay*2^(attempt-1).
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	d := t.cfg.MaxDelay
+	if attempt < 30 {
+		d = min(t.cfg.BaseDelay<<(attempt-1), t.cfg.MaxDelay)
+	}
+	return rand.N(d) + 1
+}
+
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func retryableNetError(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
+
+// retryAfter parses a Retry-After header, either delay-seconds or an HTTP date.
+func retryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
@@ -1,8 +1,59 @@
 package ai
 
-import "context"
+import (
+	"context"
+	"iter"
+	"net/http"
+)
+
+// Chunk is one piece of a streamed reply. The last chunk of a successful
+// stream has FinishReason set and carries the backend's token counts; it
+// may have an empty Delta.
+type Chunk struct {
+	Delta string
+	// Reasoning is a piece of the model's thinking, kept apart from the answer.
+	Reasoning string
+	Usage     *Usage
+	// FinishReason is set on the final chunk only, see the Finish constants.
+	FinishReason string
+	// Backend is set by composite providers, see ChatResponse.Backend.
+	Backend *Backend
+}
+
+// Finish reasons, normalised across backends.
+const (
+	FinishStop          = "stop"
+	FinishLength        = "length"
+	FinishToolCalls     = "tool_calls"
+	FinishContentFilter = "content_filter"
+)
 
 // StreamProvider is an optional interface. Providers may implement streaming chat.
+// Tool calling is only supported through Chat; req.Tools is ignored here.
+//
+// The sequence yields chunks with a nil error, and at most one non-nil error,
+// after which it ends. Stopping the iteration early, or cancelling ctx,
+// releases the underlying connection.
 type StreamProvider interface {
-	StreamChat(ctx context.Context, messages []Message) (<-chan string, <-chan error)
+	StreamChat(ctx context.Context, req ChatRequest) iter.Seq2[Chunk, error]
+}
+
+// streamClient returns a copy of c without the overall request timeout, which
+// would cut long streams short; ctx bounds the stream instead. The copy keeps
+// c's transport, so breakers and retries still apply. A nil c stays nil.
+func streamClient(c *http.Client) *http.Client {
+	if c == nil {
+		return nil
+	}
+	sc := *c
+	sc.Timeout = 0
+	return &sc
+}
+
+// finalChunk is the last chunk of a stream.
+func finalChunk(reason string, usage Usage) Chunk {
+	if reason == "" {
+		reason = FinishStop
+	}
+	return Chunk{FinishReason: reason, Usage: &usage}
 }
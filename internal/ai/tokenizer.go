@@ -0,0 +1,82 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"unicode/utf8"
+)
+
+// Tokenizer estimates how many tokens a text takes.
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// TokenCounter is an optional interface. Providers whose backend can count
+// the prompt tokens of a request exactly may implement it.
+type TokenCounter interface {
+	CountTokens(ctx context.Context, req ChatRequest) (int, error)
+}
+
+// errNoTokenCounter is returned by composite providers whose primary backend
+// can't count tokens.
+var errNoTokenCounter = errors.New("ai: backend cannot count tokens")
+
+const (
+	// messageOverheadTokens covers the role and framing of a message.
+	messageOverheadTokens = 4
+	// imageTokens is a rough per-image cost; backends charge 85 to ~1600.
+	imageTokens = 765
+)
+
+// HeuristicTokenizer assumes about four characters per token, which is close
+// for English text with BPE tokenizers and errs high for code.
+type HeuristicTokenizer struct{}
+
+func (HeuristicTokenizer) CountTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// ScaledTokenizer corrects another tokenizer by a ratio, e.g. one measured
+// against a backend's exact count.
+type ScaledTokenizer struct {
+	Base  Tokenizer
+	Ratio float64
+}
+
+func (t ScaledTokenizer) CountTokens(text string) int {
+	return int(float64(t.Base.CountTokens(text))*t.Ratio + 0.5)
+}
+
+// CountMessageTokens estimates the tokens of a whole message, including tool
+// calls and images.
+func CountMessageTokens(t Tokenizer, m Message) int {
+	n := messageOverheadTokens + t.CountTokens(m.Content) + imageTokens*len(m.Images)
+	for _, tc := range m.ToolCalls {
+		n += t.CountTokens(tc.Name) + t.CountTokens(string(tc.Arguments))
+	}
+	return n
+}
+
+// TruncateToTokens cuts text so that it fits in max tokens, keeping the
+// start and appending marker. Text that already fits is returned unchanged.
+func TruncateToTokens(t Tokenizer, text string, max int, marker string) string {
+	if t.CountTokens(text) <= max {
+		return text
+	}
+	budget := max - t.CountTokens(marker)
+	if budget <= 0 {
+		return marker
+	}
+	runes := []rune(text)
+	// longest prefix that fits
+	lo, hi := 0, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if t.CountTokens(string(runes[:mid])) <= budget {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return string(runes[:lo]) + marker
+}
@@ -0,0 +1,55 @@
+package ai
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Provider clients share one tuned transport per backend host, so keep-alive
+// connections are reused across requests, providers and models. Go's default
+// transport keeps only 2 idle connections per host, which a burst of chats to
+// one Ollama outgrows at once.
+var transports sync.Map // scheme://host -> *http.Transport
+
+const (
+	maxIdleConnsPerHost = 64
+	idleConnTimeout     = 90 * time.Second
+)
+
+func newTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          maxIdleConnsPerHost,
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+		IdleConnTimeout:       idleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// sharedTransport returns the transport of baseURL's host.
+func sharedTransport(baseURL string) *http.Transport {
+	key := baseURL
+	if u, err := url.Parse(baseURL); err == nil && u.Host != "" {
+		key = u.Scheme + "://" + u.Host
+	}
+	if t, ok := transports.Load(key); ok {
+		return t.(*http.Transport)
+	}
+	t, _ := transports.LoadOrStore(key, newTransport())
+	return t.(*http.Transport)
+}
+
+// newHTTPClient returns a client for the backend at baseURL on its shared
+// transport.
+func newHTTPClient(baseURL string) *http.Client {
+	return &http.Client{Timeout: 90 * time.Second, Transport: sharedTransport(baseURL)}
+}
@@ -0,0 +1,224 @@
+package chat
+
+import (
+	"context"
+
+	"github.com/suPer8Hu/ai-platform/internal/ai"
+)
+
+const (
+	defaultContextTokens = 8192
+	defaultReplyReserve  = 1024
+	// minContextBudget keeps a usable budget when the reserve eats the window.
+	minContextBudget = 256
+	// maxContextMessages caps the history loaded for a reply, so a budget of
+	// many tiny messages can't load a whole session.
+	maxContextMessages = 1000
+	// historyPage is how many messages loadHistory reads at a time.
+	historyPage = 50
+)
+
+// truncatedMarker ends a message cut to fit the context.
+const truncatedMarker = "\n[... truncated to fit the context window ...]"
+
+// SetTokenBudget sets the context length assumed for models whose length is
+// unknown, and the tokens reserved for the reply when it has no max_tokens.
+func (s *Service) SetTokenBudget(contextTokens, replyReserve int) {
+	if contextTokens > 0 {
+		s.contextTokens = contextTokens
+	}
+	if replyReserve > 0 {
+		s.replyReserve = replyReserve
+	}
+}
+
+// SetCatalog looks up model context lengths in c.
+func (s *Service) SetCatalog(c *ai.Catalog) {
+	s.catalog = c
+}
+
+// tokenBudget is the prompt size allowed for a session's next reply: the
+// model's context length minus the reply reserve.
+func (s *Service) tokenBudget(ctx context.Context, sess *Session, opts ai.GenerationOptions) int {
+	window := s.contextTokens
+	if opts.NumCtx != nil {
+		window = *opts.NumCtx
+	} else if s.catalog != nil {
+		provider, model := sessionBackend(sess)
+		if n := s.catalog.ContextLength(ctx, provider, model); n > 0 {
+			window = n
+		}
+	}
+	reserve := s.replyReserve
+	if opts.MaxTokens != nil {
+		reserve = *opts.MaxTokens
+	}
+	return max(window-reserve, minContextBudget)
+}
+
+// loadHistory returns the newest messages of the session (DESC) that its
+// token budget can hold. It pages back through history until the estimated
+// tokens fill the budget, the summary's messages are reached or
+// contextWindowSize messages are loaded; buildContext then makes the exact cut.
+func (s *Service) loadHistory(ctx context.Context, sess *Session, opts ai.GenerationOptions) ([]Message, error) {
+	budget := s.tokenBudget(ctx, sess, opts)
+	tok := ai.HeuristicTokenizer{}
+	var out []Message
+	var beforeID uint64
+	used := 0
+	for used < budget && len(out) < s.contextWindowSize {
+		limit := min(historyPage, s.contextWindowSize-len(out))
+		page, err := s.repo.ListMessages(ctx, sess.UserID, sess.SessionID, limit, beforeID)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range page {
+			used += ai.CountMessageTokens(tok, ai.Message{Content: m.Content, ToolCalls: m.ToolCalls, Images: make([]ai.Image, len(m.Attachments))})
+		}
+		out = append(out, page...)
+		if len(page) < limit {
+			break
+		}
+		beforeID = page[len(page)-1].ID
+		if sess.Summary != "" && beforeID <= sess.SummaryThroughID {
+			break
+		}
+	}
+	return out, nil
+}
+
+// buildContext turns DESC history into the provider messages that fit the
+// session's token budget, behind the session's system prompt and summary.
+// Estimates near the budget are checked against the backend's exact count
+// where it offers one. It also returns the ID of the oldest history message
+// kept, or 0 when none was; older ones are left to the summary.
+func (s *Service) buildContext(ctx context.Context, sess *Session, provider ai.Provider, recentDesc []Message, opts ai.GenerationOptions) ([]ai.Message, uint64, error) {
+	recentDesc, summary := withSummary(sess, recentDesc)
+	msgs, ids, err := s.toProviderMessages(ctx, recentDesc)
+	if err != nil {
+		return nil, 0, err
+	}
+	if summary != nil {
+		msgs = append([]ai.Message{*summary}, msgs...)
+	}
+	msgs = withSystemPrompt(sess, msgs)
+	budget := s.tokenBudget(ctx, sess, opts)
+	var tok ai.Tokenizer = ai.HeuristicTokenizer{}
+	fitted := fitContext(msgs, budget, tok)
+
+	tc, ok := provider.(ai.TokenCounter)
+	if !ok {
+		return fitted, oldestKept(fitted, ids), nil
+	}
+	est := countTokens(fitted, tok)
+	if est*10 < budget*8 {
+		return fitted, oldestKept(fitted, ids), nil
+	}
+	n, err := tc.CountTokens(ctx, ai.ChatRequest{Messages: fitted})
+	if err != nil || n <= budget || est == 0 {
+		return fitted, oldestKept(fitted, ids), nil
+	}
+	fitted = fitContext(msgs, budget, ai.ScaledTokenizer{Base: tok, Ratio: float64(n) / float64(est)})
+	return fitted, oldestKept(fitted, ids), nil
+}
+
+// oldestKept maps fitted messages back to the history IDs (ASC) they came
+// from. fitContext keeps the newest history messages behind the system ones,
+// so the kept ones are the last of ids.
+func oldestKept(fitted []ai.Message, ids []uint64) uint64 {
+	kept := 0
+	for _, m := range fitted {
+		if m.Role != "system" {
+			kept++
+		}
+	}
+	if kept == 0 || kept > len(ids) {
+		return 0
+	}
+	return ids[len(ids)-kept]
+}
+
+func countTokens(msgs []ai.Message, tok ai.Tokenizer) int {
+	n := 0
+	for _, m := range msgs {
+		n += ai.CountMessageTokens(tok, m)
+	}
+	return n
+}
+
+// fitContext keeps the newest ASC messages that fit in budget tokens. System
+// messages and the latest user turn are always kept. No message may take more
+// than half the budget, and pinned messages are cut further if they overflow
+// it on their own; cut messages end with truncatedMarker.
+func fitContext(msgs []ai.Message, budget int, tok ai.Tokenizer) []ai.Message {
+	msgs = append([]ai.Message(nil), msgs...)
+	for i := range msgs {
+		msgs[i].Content = ai.TruncateToTokens(tok, msgs[i].Content, budget/2, truncatedMarker)
+	}
+
+	// the latest turn starts at the last user message
+	turn := len(msgs)
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == "user" {
+			turn = i
+			break
+		}
+	}
+
+	keep := make([]bool, len(msgs))
+	used := 0
+	for i, m := range msgs {
+		if m.Role == "system" || i >= turn {
+			keep[i] = true
+			used += ai.CountMessageTokens(tok, m)
+		}
+	}
+
+	// pinned messages alone overflow: cut the largest until they fit
+	for range msgs {
+		if used <= budget {
+			break
+		}
+		largest, size := -1, 0
+		for i, m := range msgs {
+			if n := tok.CountTokens(m.Content); keep[i] && n > size {
+				largest, size = i, n
+			}
+		}
+		if largest < 0 {
+			break
+		}
+		cut := ai.TruncateToTokens(tok, msgs[largest].Content, max(size-(used-budget), 0), truncatedMarker)
+		used += tok.CountTokens(cut) - size
+		msgs[largest].Content = cut
+	}
+
+	// history, newest first, until the budget runs out
+	trimmed := false
+	for i := turn - 1; i >= 0; i-- {
+		if keep[i] {
+			continue
+		}
+		n := ai.CountMessageTokens(tok, msgs[i])
+		if used+n > budget {
+			trimmed = true
+			break
+		}
+		keep[i] = true
+		used += n
+	}
+
+	out := make([]ai.Message, 0, len(msgs))
+	for i, m := range msgs {
+		if !keep[i] {
+			continue
+		}
+		// trimmed history restarts at a user message: replies and tool
+		// results whose prompt or call was dropped can't be sent
+		if trimmed && i < turn && m.Role != "user" && m.Role != "system" && (len(out) == 0 || out[len(out)-1].Role == "system") {
+			continue
+		}
+		out = append(out, m)
+	}
+	return out
+}
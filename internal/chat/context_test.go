@@ -0,0 +1,36 @@
+package chat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/suPer8Hu/ai-platform/internal/ai"
+)
+
+func TestFitContext_KeepsPinnedAndNewestHistory(t *testing.T) {
+	tok := ai.HeuristicTokenizer{}
+	msgs := []ai.Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: strings.Repeat("old ", 100)},
+		{Role: "assistant", Content: "old reply"},
+		{Role: "user", Content: "recent"},
+		{Role: "assistant", Content: "recent reply"},
+		{Role: "user", Content: strings.Repeat("log line ", 400)},
+	}
+
+	out := fitContext(msgs, 200, tok)
+
+	if out[0].Role != "system" || out[len(out)-1].Role != "user" {
+		t.Fatalf("system prompt and latest turn must be kept, got %+v", out)
+	}
+	last := out[len(out)-1].Content
+	if !strings.HasSuffix(last, truncatedMarker) || tok.CountTokens(last) > 100 {
+		t.Fatalf("oversized message should be cut to half the budget, got %d tokens", tok.CountTokens(last))
+	}
+	if len(out) != 4 || out[1].Content != "recent" {
+		t.Fatalf("expected the oldest exchange to be dropped, got %+v", out)
+	}
+	if got := countTokens(out, tok); got > 200 {
+		t.Fatalf("context exceeds budget: %d", got)
+	}
+}
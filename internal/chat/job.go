@@ -1,6 +1,10 @@
 package chat
 
-import "time"
+import (
+	"time"
+
+	"github.com/suPer8Hu/ai-platform/internal/ai"
+)
 
 type JobStatus string
 
@@ -18,6 +22,10 @@ type Job struct {
 	SessionID string `gorm:"size:26;index;not null"`
 
 	Prompt string `gorm:"type:text;not null"`
+	// Options override the session's generation parameters for this reply.
+	Options *ai.GenerationOptions `gorm:"type:text;serializer:json"`
+	// ResponseFormat asks for a validated JSON reply.
+	ResponseFormat *ai.ResponseFormat `gorm:"type:text;serializer:json"`
 
 	IdempotencyKey *string `gorm:"type:varchar(128);index:uniq_user_idempo,unique" json:"idempotency_key"`
 
@@ -1,28 +1,99 @@
 package chat
 
-import "time"
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/suPer8Hu/ai-platform/internal/ai"
+)
 
 type Session struct {
-	ID        uint64    `gorm:"primaryKey;autoIncrement" json:"-"`
-	SessionID string    `gorm:"type:varchar(26);uniqueIndex;not null" json:"session_id"`
-	UserID    uint64    `gorm:"index;not null" json:"-"`
-	Provider  string    `gorm:"type:varchar(32);not null" json:"provider"`
-	Model     string    `gorm:"type:varchar(64);not null" json:"model"`
-	Title     string    `gorm:"type:varchar(128);not null;default:''" json:"title"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        uint64 `gorm:"primaryKey;autoIncrement" json:"-"`
+	SessionID string `gorm:"type:varchar(26);uniqueIndex;not null" json:"session_id"`
+	UserID    uint64 `gorm:"index;not null" json:"-"`
+	Provider  string `gorm:"type:varchar(32);not null" json:"provider"`
+	Model     string `gorm:"type:varchar(64);not null" json:"model"`
+	Title     string `gorm:"type:varchar(128);not null;default:''" json:"title"`
+	// FallbackChain overrides the global fallback backends for this session.
+	FallbackChain []ai.Backend `gorm:"type:text;serializer:json" json:"fallback_chain,omitempty"`
+	// Options are the session's default generation parameters.
+	Options ai.GenerationOptions `gorm:"type:text;serializer:json" json:"options"`
+	// SystemPrompt is sent first on every request of the session. It is
+	// copied from the persona, if any, when the session is created.
+	SystemPrompt string  `gorm:"type:text" json:"system_prompt,omitempty"`
+	PersonaID    *uint64 `gorm:"index" json:"persona_id,omitempty"`
+	// Summary condenses the turns that fell out of the context window, up to
+	// and including message SummaryThroughID.
+	Summary          string     `gorm:"type:text" json:"-"`
+	SummaryThroughID uint64     `gorm:"not null;default:0" json:"-"`
+	SummaryUpdatedAt *time.Time `json:"-"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
 }
 
 func (Session) TableName() string { return "chat_sessions" }
 
 type Message struct {
-	ID             uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
-	SessionID      string    `gorm:"type:varchar(26);not null;index:idx_chat_msg_user_session_id,priority:2;index:uniq_chat_msg_idempo,unique,priority:2" json:"session_id"`
-	UserID         uint64    `gorm:"not null;index:idx_chat_msg_user_session_id,priority:1;index:uniq_chat_msg_idempo,unique,priority:1" json:"-"`
-	Role           string    `gorm:"type:varchar(16);index;not null" json:"role"`
-	Content        string    `gorm:"type:text;not null" json:"content"`
-	IdempotencyKey *string   `gorm:"type:varchar(128);index:uniq_chat_msg_idempo,unique,priority:3" json:"-"`
-	CreatedAt      time.Time `json:"created_at"`
+	ID        uint64 `gorm:"primaryKey;autoIncrement" json:"id"`
+	SessionID string `gorm:"type:varchar(26);not null;index:idx_chat_msg_user_session_id,priority:2;index:uniq_chat_msg_idempo,unique,priority:2" json:"session_id"`
+	UserID    uint64 `gorm:"not null;index:idx_chat_msg_user_session_id,priority:1;index:uniq_chat_msg_idempo,unique,priority:1" json:"-"`
+	Role      string `gorm:"type:varchar(16);index;not null" json:"role"`
+	Content   string `gorm:"type:text;not null" json:"content"`
+	// Reasoning is the model's thinking; it is never sent back to the model.
+	Reasoning        string       `gorm:"type:text" json:"reasoning,omitempty"`
+	Attachments      []Attachment `gorm:"type:text;serializer:json" json:"attachments,omitempty"`
+	ToolCalls        ToolCalls    `gorm:"type:text" json:"tool_calls,omitempty"`
+	ToolCallID       string       `gorm:"type:varchar(64);not null;default:''" json:"tool_call_id,omitempty"`
+	ToolName         string       `gorm:"type:varchar(64);not null;default:''" json:"tool_name,omitempty"`
+	Provider         string       `gorm:"type:varchar(32);not null;default:''" json:"provider,omitempty"`
+	Model            string       `gorm:"type:varchar(64);not null;default:''" json:"model,omitempty"`
+	PromptTokens     int          `gorm:"not null;default:0" json:"prompt_tokens,omitempty"`
+	CompletionTokens int          `gorm:"not null;default:0" json:"completion_tokens,omitempty"`
+	LatencyMs        int64        `gorm:"not null;default:0" json:"latency_ms,omitempty"`
+	IdempotencyKey   *string      `gorm:"type:varchar(128);index:uniq_chat_msg_idempo,unique,priority:3" json:"-"`
+	CreatedAt        time.Time    `json:"created_at"`
 }
 
 func (Message) TableName() string { return "chat_messages" }
+
+// Attachment is an image part of a message; the bytes live in the blob store.
+type Attachment struct {
+	Key      string `json:"key"`
+	MimeType string `json:"mime_type"`
+	Size     int    `json:"size"`
+}
+
+// ToolCalls are the tool invocations requested by an assistant message,
+// stored as a JSON text column.
+type ToolCalls []ai.ToolCall
+
+func (t ToolCalls) Value() (driver.Value, error) {
+	if len(t) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal([]ai.ToolCall(t))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (t *ToolCalls) Scan(v any) error {
+	var b []byte
+	switch x := v.(type) {
+	case nil:
+	case []byte:
+		b = x
+	case string:
+		b = []byte(x)
+	default:
+		return fmt.Errorf("chat: cannot scan %T into ToolCalls", v)
+	}
+	if len(b) == 0 {
+		*t = nil
+		return nil
+	}
+	return json.Unmarshal(b, (*[]ai.ToolCall)(t))
+}
@@ -0,0 +1,66 @@
+package chat
+
+import (
+	"context"
+	"time"
+
+	"github.com/suPer8Hu/ai-platform/internal/ai"
+)
+
+// Persona is a user's reusable session preset: a system prompt plus default
+// backend and generation parameters.
+type Persona struct {
+	ID           uint64 `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID       uint64 `gorm:"index;not null" json:"-"`
+	Name         string `gorm:"type:varchar(64);not null" json:"name"`
+	SystemPrompt string `gorm:"type:text;not null" json:"system_prompt"`
+	// Provider and Model, when set, are the defaults of sessions created
+	// from the persona.
+	Provider  string               `gorm:"type:varchar(32);not null;default:''" json:"provider,omitempty"`
+	Model     string               `gorm:"type:varchar(64);not null;default:''" json:"model,omitempty"`
+	Options   ai.GenerationOptions `gorm:"type:text;serializer:json" json:"options"`
+	CreatedAt time.Time            `json:"created_at"`
+	UpdatedAt time.Time            `json:"updated_at"`
+}
+
+func (Persona) TableName() string { return "chat_personas" }
+
+func (s *Service) CreatePersona(ctx context.Context, userID uint64, p *Persona) error {
+	p.ID = 0
+	p.UserID = userID
+	return s.repo.CreatePersona(ctx, p)
+}
+
+// GetPersona returns gorm.ErrRecordNotFound for other users' personas.
+func (s *Service) GetPersona(ctx context.Context, userID, id uint64) (*Persona, error) {
+	return s.repo.GetPersona(ctx, userID, id)
+}
+
+func (s *Service) ListPersonas(ctx context.Context, userID uint64) ([]Persona, error) {
+	return s.repo.ListPersonas(ctx, userID)
+}
+
+// UpdatePersona replaces a persona's fields. Sessions already created from
+// it keep the system prompt they were created with.
+func (s *Service) UpdatePersona(ctx context.Context, userID uint64, p *Persona) error {
+	if _, err := s.repo.GetPersona(ctx, userID, p.ID); err != nil {
+		return err
+	}
+	p.UserID = userID
+	return s.repo.UpdatePersona(ctx, p)
+}
+
+func (s *Service) DeletePersona(ctx context.Context, userID, id uint64) error {
+	if _, err := s.repo.GetPersona(ctx, userID, id); err != nil {
+		return err
+	}
+	return s.repo.DeletePersona(ctx, userID, id)
+}
+
+// withSystemPrompt puts the session's system prompt in front of msgs.
+func withSystemPrompt(sess *Session, msgs []ai.Message) []ai.Message {
+	if sess.SystemPrompt == "" {
+		return msgs
+	}
+	return append([]ai.Message{{Role: "system", Content: sess.SystemPrompt}}, msgs...)
+}
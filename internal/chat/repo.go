@@ -3,7 +3,9 @@ package chat
 import (
 	"context"
 	"errors"
+	"time"
 
+	"github.com/suPer8Hu/ai-platform/internal/ai"
 	"gorm.io/gorm"
 )
 
@@ -36,6 +38,14 @@ func (r *Repo) UpdateSessionTitle(ctx context.Context, userID uint64, sessionID,
 		Update("title", title).Error
 }
 
+func (r *Repo) UpdateSessionOptions(ctx context.Context, userID uint64, sessionID string, opts ai.GenerationOptions) error {
+	return r.db.WithContext(ctx).
+		Model(&Session{}).
+		Where("session_id = ? AND user_id = ?", sessionID, userID).
+		Select("options").
+		Updates(&Session{Options: opts}).Error
+}
+
 func (r *Repo) DeleteSessionCascade(ctx context.Context, userID uint64, sessionID string) error {
 	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		if err := tx.Where("user_id = ? AND session_id = ?", userID, sessionID).
@@ -54,6 +64,31 @@ func (r *Repo) DeleteSessionCascade(ctx context.Context, userID uint64, sessionI
 	})
 }
 
+// ListSessionAttachments returns the attachments of every message in a session.
+func (r *Repo) ListSessionAttachments(ctx context.Context, userID uint64, sessionID string) ([]Attachment, error) {
+	return r.listAttachments(ctx, "user_id = ? AND session_id = ?", userID, sessionID)
+}
+
+// ListUserAttachments returns the attachments of every message of a user.
+func (r *Repo) ListUserAttachments(ctx context.Context, userID uint64) ([]Attachment, error) {
+	return r.listAttachments(ctx, "user_id = ?", userID)
+}
+
+func (r *Repo) listAttachments(ctx context.Context, where string, args ...any) ([]Attachment, error) {
+	var msgs []Message
+	if err := r.db.WithContext(ctx).
+		Select("id", "attachments").
+		Where(where+" AND attachments IS NOT NULL", args...).
+		Find(&msgs).Error; err != nil {
+		return nil, err
+	}
+	var out []Attachment
+	for _, m := range msgs {
+		out = append(out, m.Attachments...)
+	}
+	return out, nil
+}
+
 // Uses numeric DB primary key pagination with beforeID (id < beforeID).
 func (r *Repo) ListSessions(ctx context.Context, userID uint64, limit int, beforeID uint64) ([]Session, error) {
 	q := r.db.WithContext(ctx).
@@ -78,6 +113,16 @@ func (r *Repo) InsertMessage(ctx context.Context, m *Message) error {
 	return r.db.WithContext(ctx).Create(m).Error
 }
 
+func (r *Repo) GetMessageByID(ctx context.Context, userID uint64, id uint64) (*Message, error) {
+	var m Message
+	if err := r.db.WithContext(ctx).
+		Where("id = ? AND user_id = ?", id, userID).
+		First(&m).Error; err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
 // ListMessages returns messages in DESC id order (newest -> oldest).
 func (r *Repo) ListMessages(ctx context.Context, userID uint64, sessionID string, limit int, beforeID uint64) ([]Message, error) {
 	q := r.db.WithContext(ctx).
@@ -112,6 +157,76 @@ func (r *Repo) ListRecentMessagesDesc(ctx context.Context, userID uint64, sessio
 	return msgs, nil
 }
 
+// ListMessagesBetween returns up to limit messages with afterID < id < beforeID
+// in ASC id order (oldest -> newest).
+func (r *Repo) ListMessagesBetween(ctx context.Context, userID uint64, sessionID string, afterID, beforeID uint64, limit int) ([]Message, error) {
+	var msgs []Message
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ? AND session_id = ? AND id > ? AND id < ?", userID, sessionID, afterID, beforeID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&msgs).Error; err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+// UpdateSessionSummary stores a new summary unless another writer moved the
+// summary since it was read at prevThroughID.
+// updated_at is left alone so sessions don't reorder in the list.
+func (r *Repo) UpdateSessionSummary(ctx context.Context, userID uint64, sessionID, summary string, throughID, prevThroughID uint64) error {
+	now := time.Now()
+	return r.db.WithContext(ctx).
+		Model(&Session{}).
+		Where("session_id = ? AND user_id = ? AND summary_through_id = ?", sessionID, userID, prevThroughID).
+		UpdateColumns(map[string]any{
+			"summary":            summary,
+			"summary_through_id": throughID,
+			"summary_updated_at": &now,
+		}).Error
+}
+
+// Persona CRUD
+
+func (r *Repo) CreatePersona(ctx context.Context, p *Persona) error {
+	return r.db.WithContext(ctx).Create(p).Error
+}
+
+func (r *Repo) GetPersona(ctx context.Context, userID, id uint64) (*Persona, error) {
+	var p Persona
+	if err := r.db.WithContext(ctx).
+		Where("id = ? AND user_id = ?", id, userID).
+		First(&p).Error; err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *Repo) ListPersonas(ctx context.Context, userID uint64) ([]Persona, error) {
+	var ps []Persona
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("id ASC").
+		Find(&ps).Error; err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
+
+func (r *Repo) UpdatePersona(ctx context.Context, p *Persona) error {
+	return r.db.WithContext(ctx).
+		Model(&Persona{}).
+		Where("id = ? AND user_id = ?", p.ID, p.UserID).
+		Select("name", "system_prompt", "provider", "model", "options").
+		Updates(p).Error
+}
+
+func (r *Repo) DeletePersona(ctx context.Context, userID, id uint64) error {
+	return r.db.WithContext(ctx).
+		Where("id = ? AND user_id = ?", id, userID).
+		Delete(&Persona{}).Error
+}
+
 // Job CRUD
 func (r *Repo) CreateJob(ctx context.Context, job *Job) error {
 	return r.db.WithContext(ctx).Create(job).Error
@@ -202,16 +317,11 @@ func (r *Repo) GetUserMessageByIdempotencyKey(ctx context.Context, userID uint64
 	return &msg, nil
 }
 
-// InsertUserMessageOrGetExisting inserts a user message, but if the same (user_id, session_id, idempotency_key)
-// already exists, it returns the existing one instead.
-func (r *Repo) InsertUserMessageOrGetExisting(ctx context.Context, userID uint64, sessionID string, content string, key *string) (*Message, bool, error) {
-	msg := &Message{
-		UserID:         userID,
-		SessionID:      sessionID,
-		Role:           "user",
-		Content:        content,
-		IdempotencyKey: nil,
-	}
+// InsertUserMessageOrGetExisting inserts msg, or returns the message already
+// stored under the same idempotency key.
+func (r *Repo) InsertUserMessageOrGetExisting(ctx context.Context, msg *Message, key *string) (*Message, bool, error) {
+	userID, sessionID := msg.UserID, msg.SessionID
+	msg.IdempotencyKey = nil
 
 	if key == nil || *key == "" {
 		if err := r.db.WithContext(ctx).Create(msg).Error; err != nil {
@@ -3,32 +3,84 @@ package chat
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/suPer8Hu/ai-platform/internal/ai"
+	"github.com/suPer8Hu/ai-platform/internal/store/blobstore"
 	"gorm.io/gorm"
 )
 
 type Service struct {
-	repo              *Repo
-	registry          *ai.Registry
+	repo     *Repo
+	registry *ai.Registry
+	// contextWindowSize is a safety cap on the history messages loaded for
+	// a reply; the token budget decides how many of them are loaded and sent.
 	contextWindowSize int
+	contextTokens     int
+	replyReserve      int
+	// catalog, when set, provides model context lengths.
+	catalog *ai.Catalog
+	// fallbackChain is tried when a session's own backend is unavailable,
+	// unless the session names its own chain.
+	fallbackChain []ai.Backend
+	// blobs holds image attachments; nil disables them.
+	blobs blobstore.Store
+	// backgroundSummaries updates summaries after sync and streamed replies;
+	// summarizing holds the sessions being updated.
+	backgroundSummaries bool
+	summarizing         sync.Map
 }
 
+// ErrAttachmentsDisabled is returned for images when no blob store is configured.
+var ErrAttachmentsDisabled = errors.New("chat: attachments are not enabled")
+
 func NewService(repo *Repo, registry *ai.Registry, contextWindowSize int) *Service {
-	if contextWindowSize <= 0 || contextWindowSize > 100 {
-		contextWindowSize = 20
+	if contextWindowSize <= 0 || contextWindowSize > maxContextMessages {
+		contextWindowSize = maxContextMessages
+	}
+	return &Service{
+		repo:              repo,
+		registry:          registry,
+		contextWindowSize: contextWindowSize,
+		contextTokens:     defaultContextTokens,
+		replyReserve:      defaultReplyReserve,
 	}
-	return &Service{repo: repo, registry: registry, contextWindowSize: contextWindowSize}
 }
 
+// SetFallbackChain sets the global fallback backends.
+func (s *Service) SetFallbackChain(chain []ai.Backend) {
+	s.fallbackChain = chain
+}
+
+// SetBlobStore enables image attachments.
+func (s *Service) SetBlobStore(store blobstore.Store) {
+	s.blobs = store
+}
+
+func (s *Service) AttachmentsEnabled() bool { return s.blobs != nil }
+
 const (
 	defaultProvider = "ollama"
 	defaultModel    = "llama3:latest"
 )
 
-func (s *Service) CreateSession(ctx context.Context, userID uint64, provider, model string) (*Session, error) {
+// SessionParams are the caller-chosen settings of a new session.
+type SessionParams struct {
+	Provider string
+	Model    string
+	Options  ai.GenerationOptions
+	// FallbackChain, when set, replaces the global fallback chain.
+	FallbackChain []ai.Backend
+	SystemPrompt  string
+	// PersonaID records the persona the session was created from.
+	PersonaID *uint64
+}
+
+func (s *Service) CreateSession(ctx context.Context, userID uint64, params SessionParams) (*Session, error) {
+	provider, model := params.Provider, params.Model
 	if provider == "" {
 		provider = defaultProvider
 	}
@@ -42,10 +94,14 @@ func (s *Service) CreateSession(ctx context.Context, userID uint64, provider, mo
 	}
 
 	session := &Session{
-		SessionID: sid,
-		UserID:    userID,
-		Provider:  provider,
-		Model:     model,
+		SessionID:     sid,
+		UserID:        userID,
+		Provider:      provider,
+		Model:         model,
+		Options:       params.Options,
+		FallbackChain: params.FallbackChain,
+		SystemPrompt:  params.SystemPrompt,
+		PersonaID:     params.PersonaID,
 	}
 
 	if err := s.repo.CreateSession(ctx, session); err != nil {
@@ -54,16 +110,48 @@ func (s *Service) CreateSession(ctx context.Context, userID uint64, provider, mo
 	return session, nil
 }
 
+// sessionBackend resolves the provider/model a session is routed to.
+func sessionBackend(sess *Session) (provider, model string) {
+	provider, model = sess.Provider, sess.Model
+	if provider == "" {
+		provider = defaultProvider
+	}
+	if model == "" {
+		model = defaultModel
+	}
+	return provider, model
+}
+
+// providerForSession returns the session's provider, wrapped in a fallback
+// chain when the session or the global config names one.
 func (s *Service) providerForSession(ctx context.Context, sess *Session) (ai.Provider, error) {
-	p := sess.Provider
-	m := sess.Model
-	if p == "" {
-		p = defaultProvider
+	p, m := sessionBackend(sess)
+	chain := sess.FallbackChain
+	if len(chain) == 0 {
+		chain = s.fallbackChain
 	}
-	if m == "" {
-		m = defaultModel
+	return s.registry.Chain(ctx, ai.Backend{Provider: p, Model: m}, chain)
+}
+
+// newAssistantMessage builds the assistant row for a reply, recording which
+// backend produced it, its token usage and how long it took. backend is the
+// one that actually answered when a fallback kicked in, nil otherwise.
+func newAssistantMessage(sess *Session, content string, usage ai.Usage, backend *ai.Backend, latency time.Duration) *Message {
+	p, m := sessionBackend(sess)
+	if backend != nil {
+		p, m = backend.Provider, backend.Model
+	}
+	return &Message{
+		SessionID:        sess.SessionID,
+		UserID:           sess.UserID,
+		Role:             "assistant",
+		Content:          content,
+		Provider:         p,
+		Model:            m,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		LatencyMs:        latency.Milliseconds(),
 	}
-	return s.registry.Get(ctx, p, m)
 }
 
 func (s *Service) ListSessions(ctx context.Context, userID uint64, limit int, beforeID uint64) ([]Session, error) {
@@ -80,200 +168,397 @@ func (s *Service) UpdateSessionTitle(ctx context.Context, userID uint64, session
 	return s.repo.UpdateSessionTitle(ctx, userID, sessionID, title)
 }
 
+// UpdateSessionOptions replaces the session's default generation parameters.
+func (s *Service) UpdateSessionOptions(ctx context.Context, userID uint64, sessionID string, opts ai.GenerationOptions) error {
+	if err := s.ValidateSessionOwner(ctx, userID, sessionID); err != nil {
+		return err
+	}
+	return s.repo.UpdateSessionOptions(ctx, userID, sessionID, opts)
+}
+
 func (s *Service) DeleteSession(ctx context.Context, userID uint64, sessionID string) error {
 	if err := s.ValidateSessionOwner(ctx, userID, sessionID); err != nil {
 		return err
 	}
-	return s.repo.DeleteSessionCascade(ctx, userID, sessionID)
+	var atts []Attachment
+	if s.blobs != nil {
+		var err error
+		if atts, err = s.repo.ListSessionAttachments(ctx, userID, sessionID); err != nil {
+			return err
+		}
+	}
+	if err := s.repo.DeleteSessionCascade(ctx, userID, sessionID); err != nil {
+		return err
+	}
+	s.discardAttachments(ctx, atts)
+	return nil
+}
+
+// UserAttachments returns the attachments of every message of a user, to be
+// discarded once the user's messages are deleted. Without a blob store there
+// are none.
+func (s *Service) UserAttachments(ctx context.Context, userID uint64) ([]Attachment, error) {
+	if s.blobs == nil {
+		return nil, nil
+	}
+	return s.repo.ListUserAttachments(ctx, userID)
+}
+
+// DiscardAttachments removes the blobs of deleted messages, best effort.
+func (s *Service) DiscardAttachments(ctx context.Context, atts []Attachment) {
+	s.discardAttachments(ctx, atts)
+}
+
+// ImageInput is an image uploaded with a user message.
+type ImageInput struct {
+	MimeType string
+	Data     []byte
+}
+
+// storeImages puts uploaded images in the blob store.
+func (s *Service) storeImages(ctx context.Context, images []ImageInput) ([]Attachment, error) {
+	if len(images) == 0 {
+		return nil, nil
+	}
+	if s.blobs == nil {
+		return nil, ErrAttachmentsDisabled
+	}
+	out := make([]Attachment, 0, len(images))
+	for _, img := range images {
+		key, err := s.blobs.Put(ctx, img.Data)
+		if err != nil {
+			s.discardAttachments(ctx, out)
+			return nil, err
+		}
+		out = append(out, Attachment{Key: key, MimeType: img.MimeType, Size: len(img.Data)})
+	}
+	return out, nil
+}
+
+// discardAttachments removes blobs that are no longer referenced, best effort.
+func (s *Service) discardAttachments(ctx context.Context, atts []Attachment) {
+	for _, a := range atts {
+		_ = s.blobs.Delete(ctx, a.Key)
+	}
+}
+
+// newUserMessage stores the images of a user turn and builds its row.
+func (s *Service) newUserMessage(ctx context.Context, userID uint64, sessionID, content string, images []ImageInput) (*Message, error) {
+	atts, err := s.storeImages(ctx, images)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{
+		SessionID:   sessionID,
+		UserID:      userID,
+		Role:        "user",
+		Content:     content,
+		Attachments: atts,
+	}, nil
+}
+
+// insertUserMessage inserts msg, deduplicated by key when set. When an
+// earlier message with the same key exists, msg's fresh attachments are dropped.
+func (s *Service) insertUserMessage(ctx context.Context, msg *Message, key *string) (*Message, bool, error) {
+	stored, created, err := s.repo.InsertUserMessageOrGetExisting(ctx, msg, key)
+	if err != nil || !created {
+		s.discardAttachments(ctx, msg.Attachments)
+	}
+	return stored, created, err
+}
+
+// ToolResult is the output of a tool call the client executed on the model's behalf.
+type ToolResult struct {
+	ToolCallID string
+	Name       string
+	Content    string
+}
+
+// SendInput is one turn sent by the user: a text message and/or the results
+// of the tool calls requested by the previous assistant message, plus the
+// tools the model may call in its reply.
+type SendInput struct {
+	Content     string
+	Images      []ImageInput
+	Tools       []ai.Tool
+	ToolResults []ToolResult
+	// Options override the session's generation parameters for this reply only.
+	Options *ai.GenerationOptions
+	// ResponseFormat asks for a JSON reply; the stored reply is the validated,
+	// compacted JSON.
+	ResponseFormat *ai.ResponseFormat
 }
 
 func (s *Service) SendMessage(ctx context.Context, userID uint64, sessionID string, content string) (reply string, assistantMsgID uint64, err error) {
+	msg, err := s.Send(ctx, userID, sessionID, SendInput{Content: content})
+	if err != nil {
+		return "", 0, err
+	}
+	return msg.Content, msg.ID, nil
+}
+
+// Send stores the user turn, asks the session's provider for a reply and
+// stores it. The returned assistant message may carry ToolCalls for the
+// client to execute and answer with ToolResults in the next turn.
+func (s *Service) Send(ctx context.Context, userID uint64, sessionID string, in SendInput) (*Message, error) {
+	// keep the session on one backend node, see ai.OllamaPool
+	ctx = ai.WithAffinity(ctx, sessionID)
+
 	// 1) verify session ownership
 	session, err := s.repo.GetSessionBySessionID(ctx, sessionID)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return "", 0, err
+			return nil, err
 		}
-		return "", 0, err
+		return nil, err
 	}
 	if session.UserID != userID {
-		return "", 0, gorm.ErrRecordNotFound
+		return nil, gorm.ErrRecordNotFound
 	}
 
 	//  pick provider/model for this session
 	provider, err := s.providerForSession(ctx, session)
 	if err != nil {
-		return "", 0, err
+		return nil, err
 	}
 
-	// 2) store user message (strong consistency)
-	userMsg := &Message{
-		SessionID: sessionID,
-		UserID:    userID,
-		Role:      "user",
-		Content:   content,
+	// 2) store tool results and the user message (strong consistency)
+	for _, tr := range in.ToolResults {
+		if err := s.repo.InsertMessage(ctx, &Message{
+			SessionID:  sessionID,
+			UserID:     userID,
+			Role:       "tool",
+			Content:    tr.Content,
+			ToolCallID: tr.ToolCallID,
+			ToolName:   tr.Name,
+		}); err != nil {
+			return nil, err
+		}
 	}
-	if err := s.repo.InsertMessage(ctx, userMsg); err != nil {
-		return "", 0, err
+	if in.Content != "" || len(in.Images) > 0 {
+		userMsg, err := s.newUserMessage(ctx, userID, sessionID, in.Content, in.Images)
+		if err != nil {
+			return nil, err
+		}
+		if _, _, err := s.insertUserMessage(ctx, userMsg, nil); err != nil {
+			return nil, err
+		}
+		s.maybeSetSessionTitle(ctx, userID, sessionID, in.Content)
 	}
-	s.maybeSetSessionTitle(ctx, userID, sessionID, content)
 
 	// 3) build provider messages from recent DB history
-	recentDesc, err := s.repo.ListRecentMessagesDesc(ctx, userID, sessionID, s.contextWindowSize)
+	opts := session.Options.Merge(in.Options)
+	recentDesc, err := s.loadHistory(ctx, session, opts)
 	if err != nil {
-		return "", 0, err
+		return nil, err
 	}
-
-	// reverse to ASC (oldest -> newest)
-	providerMsgs := make([]ai.Message, 0, len(recentDesc))
-	for i := len(recentDesc) - 1; i >= 0; i-- {
-		m := recentDesc[i]
-		providerMsgs = append(providerMsgs, ai.Message{
-			Role:    m.Role,
-			Content: m.Content,
-		})
+	providerMsgs, _, err := s.buildContext(ctx, session, provider, recentDesc, opts)
+	if err != nil {
+		return nil, err
 	}
 
 	// 4) call provider
-	reply, err = provider.Chat(ctx, providerMsgs)
+	start := time.Now()
+	resp, err := chat(ctx, provider, ai.ChatRequest{
+		Messages:       providerMsgs,
+		Tools:          in.Tools,
+		Options:        opts,
+		ResponseFormat: in.ResponseFormat,
+	})
 	if err != nil {
-		return "", 0, err
+		return nil, err
 	}
 
 	// 5) store assistant message (strong consistency)
-	assistantMsg := &Message{
-		SessionID: sessionID,
-		UserID:    userID,
-		Role:      "assistant",
-		Content:   reply,
-	}
+	assistantMsg := newAssistantMessage(session, resp.Content, resp.Usage, resp.Backend, time.Since(start))
+	assistantMsg.Reasoning = resp.Reasoning
+	assistantMsg.ToolCalls = resp.ToolCalls
 	if err := s.repo.InsertMessage(ctx, assistantMsg); err != nil {
-		return "", 0, err
+		return nil, err
 	}
+	s.updateSummaryInBackground(userID, sessionID)
 
-	return reply, assistantMsg.ID, nil
+	return assistantMsg, nil
 }
 
-func (s *Service) ListMessages(ctx context.Context, userID uint64, sessionID string, limit int, beforeID uint64) ([]Message, error) {
-	if limit <= 0 || limit > 100 {
-		limit = 50
+// chat calls the provider and, when a response format is set, validates the
+// reply, re-prompting once with the validation error if the format asks for
+// it. Replies that carry tool calls aren't validated.
+func chat(ctx context.Context, provider ai.Provider, req ai.ChatRequest) (ai.ChatResponse, error) {
+	resp, err := provider.Chat(ctx, req)
+	if err != nil || req.ResponseFormat == nil || len(resp.ToolCalls) > 0 {
+		return resp, err
+	}
+	parsed, perr := req.ResponseFormat.ParseJSONReply(resp.Content)
+	if perr != nil && req.ResponseFormat.Retry {
+		usage := resp.Usage
+		req.Messages = append(req.Messages[:len(req.Messages):len(req.Messages)],
+			ai.Message{Role: "assistant", Content: resp.Content},
+			ai.Message{Role: "user", Content: fmt.Sprintf("Your reply was not valid: %v. Reply again with only the corrected JSON.", perr)},
+		)
+		if resp, err = provider.Chat(ctx, req); err != nil {
+			return resp, err
+		}
+		resp.Usage.PromptTokens += usage.PromptTokens
+		resp.Usage.CompletionTokens += usage.CompletionTokens
+		parsed, perr = req.ResponseFormat.ParseJSONReply(resp.Content)
 	}
-	return s.repo.ListMessages(ctx, userID, sessionID, limit, beforeID)
+	if perr != nil {
+		return resp, perr
+	}
+	resp.Content = string(parsed)
+	return resp, nil
 }
 
-// SendMessageStream stores the user message immediately, streams assistant chunks,
-// and finally stores the assistant message after streaming completes.
-func (s *Service) SendMessageStream(ctx context.Context, userID uint64, sessionID string, content string, idempoKey *string) (chunks <-chan string, done <-chan struct{}, assistantMsgID <-chan uint64, errs <-chan error) {
-	outChunks := make(chan string, 16)
-	outDone := make(chan struct{})
-	outMsgID := make(chan uint64, 1)
-	outErrs := make(chan error, 1)
-
-	go func() {
-		defer close(outChunks)
-		defer close(outDone)
-		defer close(outMsgID)
-		defer close(outErrs)
-
-		// 1) session ownership check
-		sess, err := s.repo.GetSessionBySessionID(ctx, sessionID)
-		if err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				outErrs <- gorm.ErrRecordNotFound
-				return
+// toProviderMessages turns DESC history into ASC provider messages. Tool
+// results whose assistant call fell out of the window are dropped, since
+// providers reject tool messages that don't follow a matching call. Image
+// attachments are loaded back from the blob store. ids holds the message
+// ID of each provider message.
+func (s *Service) toProviderMessages(ctx context.Context, recentDesc []Message) ([]ai.Message, []uint64, error) {
+	out := make([]ai.Message, 0, len(recentDesc))
+	ids := make([]uint64, 0, len(recentDesc))
+	callNames := make(map[string]string)
+	for i := len(recentDesc) - 1; i >= 0; i-- {
+		m := recentDesc[i]
+		if m.Role == "tool" {
+			name, ok := callNames[m.ToolCallID]
+			if !ok {
+				continue
 			}
-			outErrs <- err
-			return
+			if m.ToolName != "" {
+				name = m.ToolName
+			}
+			out = append(out, ai.Message{Role: m.Role, Content: m.Content, ToolCallID: m.ToolCallID, Name: name})
+			ids = append(ids, m.ID)
+			continue
 		}
-		if sess.UserID != userID {
-			outErrs <- gorm.ErrRecordNotFound
-			return
+		for _, tc := range m.ToolCalls {
+			callNames[tc.ID] = tc.Name
 		}
-
-		// pick provider/model for this session
-		provider, err := s.providerForSession(ctx, sess)
+		images, err := s.loadImages(ctx, m.Attachments)
 		if err != nil {
-			outErrs <- err
-			return
+			return nil, nil, err
 		}
+		out = append(out, ai.Message{Role: m.Role, Content: m.Content, Images: images, ToolCalls: m.ToolCalls})
+		ids = append(ids, m.ID)
+	}
+	return out, ids, nil
+}
 
-		// 2) insert user message (idempotent if key provided)
-		if idempoKey != nil && *idempoKey != "" {
-			_, _, err := s.repo.InsertUserMessageOrGetExisting(ctx, userID, sessionID, content, idempoKey)
-			if err != nil {
-				outErrs <- err
-				return
-			}
-		} else {
-			userMsg := &Message{
-				SessionID: sessionID,
-				UserID:    userID,
-				Role:      "user",
-				Content:   content,
-			}
-			if err := s.repo.InsertMessage(ctx, userMsg); err != nil {
-				outErrs <- err
-				return
-			}
+// loadImages reads attachments back; blobs that went missing are skipped so
+// one lost file doesn't break the whole session.
+func (s *Service) loadImages(ctx context.Context, atts []Attachment) ([]ai.Image, error) {
+	if len(atts) == 0 || s.blobs == nil {
+		return nil, nil
+	}
+	out := make([]ai.Image, 0, len(atts))
+	for _, a := range atts {
+		data, err := s.blobs.Get(ctx, a.Key)
+		if errors.Is(err, blobstore.ErrNotFound) {
+			continue
 		}
-		s.maybeSetSessionTitle(ctx, userID, sessionID, content)
-
-		// 3) load recent messages, build provider context (ASC)
-		recentDesc, err := s.repo.ListRecentMessagesDesc(ctx, userID, sessionID, s.contextWindowSize)
 		if err != nil {
-			outErrs <- err
-			return
-		}
-		providerMsgs := make([]ai.Message, 0, len(recentDesc))
-		for i := len(recentDesc) - 1; i >= 0; i-- {
-			m := recentDesc[i]
-			providerMsgs = append(providerMsgs, ai.Message{Role: m.Role, Content: m.Content})
-		}
-
-		sp, ok := provider.(ai.StreamProvider)
-		if !ok {
-			outErrs <- errors.New("provider does not support streaming")
-			return
+			return nil, err
 		}
+		out = append(out, ai.Image{MimeType: a.MimeType, Data: data})
+	}
+	return out, nil
+}
 
-		// 4) stream from provider
-		pChunks, pErrs := sp.StreamChat(ctx, providerMsgs)
+func (s *Service) ListMessages(ctx context.Context, userID uint64, sessionID string, limit int, beforeID uint64) ([]Message, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	return s.repo.ListMessages(ctx, userID, sessionID, limit, beforeID)
+}
 
-		var b strings.Builder
-		for c := range pChunks {
-			b.WriteString(c)
-			outChunks <- c
+// SendMessageStream stores the user message immediately, passes each assistant
+// chunk (answer and reasoning deltas, then a final chunk with the finish reason
+// and usage) to emit, and stores the assistant message once the stream is
+// complete. It returns when the stream ends; if emit returns an error, the
+// stream is abandoned and nothing is stored.
+func (s *Service) SendMessageStream(ctx context.Context, userID uint64, sessionID string, in SendInput, idempoKey *string, emit func(ai.Chunk) error) (*Message, error) {
+	ctx = ai.WithAffinity(ctx, sessionID)
+	// 1) session ownership check
+	sess, err := s.repo.GetSessionBySessionID(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorm.ErrRecordNotFound
 		}
+		return nil, err
+	}
+	if sess.UserID != userID {
+		return nil, gorm.ErrRecordNotFound
+	}
 
-		// provider error (if any)
-		select {
-		case err := <-pErrs:
-			if err != nil {
-				outErrs <- err
-				return
-			}
-		default:
-			// no error sent
-		}
+	// pick provider/model for this session
+	provider, err := s.providerForSession(ctx, sess)
+	if err != nil {
+		return nil, err
+	}
+	sp, ok := provider.(ai.StreamProvider)
+	if !ok {
+		return nil, errors.New("provider does not support streaming")
+	}
+
+	// 2) insert user message (idempotent if key provided)
+	userMsg, err := s.newUserMessage(ctx, userID, sessionID, in.Content, in.Images)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := s.insertUserMessage(ctx, userMsg, idempoKey); err != nil {
+		return nil, err
+	}
+	s.maybeSetSessionTitle(ctx, userID, sessionID, in.Content)
 
-		reply := b.String()
+	// 3) load recent messages, build provider context (ASC)
+	opts := sess.Options.Merge(in.Options)
+	recentDesc, err := s.loadHistory(ctx, sess, opts)
+	if err != nil {
+		return nil, err
+	}
+	providerMsgs, _, err := s.buildContext(ctx, sess, provider, recentDesc, opts)
+	if err != nil {
+		return nil, err
+	}
 
-		// 5) insert assistant message at the end
-		assistantMsg := &Message{
-			SessionID: sessionID,
-			UserID:    userID,
-			Role:      "assistant",
-			Content:   reply,
+	// 4) stream from provider
+	start := time.Now()
+	var b, reasoning strings.Builder
+	var usage ai.Usage
+	var backend *ai.Backend
+	for c, err := range sp.StreamChat(ctx, ai.ChatRequest{
+		Messages: providerMsgs,
+		Options:  opts,
+	}) {
+		if err != nil {
+			return nil, err
 		}
-		if err := s.repo.InsertMessage(ctx, assistantMsg); err != nil {
-			outErrs <- err
-			return
+		if c.Usage != nil {
+			usage = *c.Usage
 		}
+		if c.Backend != nil {
+			backend = c.Backend
+		}
+		b.WriteString(c.Delta)
+		reasoning.WriteString(c.Reasoning)
+		if c.Delta == "" && c.Reasoning == "" && c.FinishReason == "" {
+			continue
+		}
+		if err := emit(ai.Chunk{Delta: c.Delta, Reasoning: c.Reasoning, Usage: c.Usage, FinishReason: c.FinishReason}); err != nil {
+			return nil, err
+		}
+	}
 
-		outMsgID <- assistantMsg.ID
-	}()
-
-	return outChunks, outDone, outMsgID, outErrs
+	// 5) insert assistant message at the end
+	assistantMsg := newAssistantMessage(sess, b.String(), usage, backend, time.Since(start))
+	assistantMsg.Reasoning = reasoning.String()
+	if err := s.repo.InsertMessage(ctx, assistantMsg); err != nil {
+		return nil, err
+	}
+	s.updateSummaryInBackground(userID, sessionID)
+	return assistantMsg, nil
 }
 
 func (s *Service) ValidateSessionOwner(ctx context.Context, userID uint64, sessionID string) error {
@@ -290,22 +575,26 @@ func (s *Service) ValidateSessionOwner(ctx context.Context, userID uint64, sessi
 	return nil
 }
 
-func (s *Service) InsertUserMessage(ctx context.Context, userID uint64, sessionID string, content string) error {
+func (s *Service) InsertUserMessage(ctx context.Context, userID uint64, sessionID string, content string, images []ImageInput) error {
 	if err := s.ValidateSessionOwner(ctx, userID, sessionID); err != nil {
 		return err
 	}
-	if err := s.repo.InsertMessage(ctx, &Message{
-		SessionID: sessionID,
-		UserID:    userID,
-		Role:      "user",
-		Content:   content,
-	}); err != nil {
+	msg, err := s.newUserMessage(ctx, userID, sessionID, content, images)
+	if err != nil {
+		return err
+	}
+	if _, _, err := s.insertUserMessage(ctx, msg, nil); err != nil {
 		return err
 	}
 	s.maybeSetSessionTitle(ctx, userID, sessionID, content)
 	return nil
 }
 
+// GetMessage returns one of the user's messages by its numeric ID.
+func (s *Service) GetMessage(ctx context.Context, userID uint64, id uint64) (*Message, error) {
+	return s.repo.GetMessageByID(ctx, userID, id)
+}
+
 func (s *Service) CreateJob(ctx context.Context, job *Job) error {
 	return s.repo.CreateJob(ctx, job)
 }
@@ -314,7 +603,11 @@ func (s *Service) GetJob(ctx context.Context, jobID string) (*Job, error) {
 	return s.repo.GetJobByID(ctx, jobID)
 }
 
-func (s *Service) GenerateAssistantReplyAndInsert(ctx context.Context, userID uint64, sessionID string) (string, uint64, error) {
+// GenerateAssistantReplyAndInsert answers the latest history of a session.
+// opts, when set, override the session's generation parameters; format, when
+// set, asks for a validated JSON reply.
+func (s *Service) GenerateAssistantReplyAndInsert(ctx context.Context, userID uint64, sessionID string, opts *ai.GenerationOptions, format *ai.ResponseFormat) (string, uint64, error) {
+	ctx = ai.WithAffinity(ctx, sessionID)
 	// session ownership check + get session for provider routing
 	sess, err := s.repo.GetSessionBySessionID(ctx, sessionID)
 	if err != nil {
@@ -332,41 +625,43 @@ func (s *Service) GenerateAssistantReplyAndInsert(ctx context.Context, userID ui
 		return "", 0, err
 	}
 
-	recentDesc, err := s.repo.ListRecentMessagesDesc(ctx, userID, sessionID, s.contextWindowSize)
+	merged := sess.Options.Merge(opts)
+	recentDesc, err := s.loadHistory(ctx, sess, merged)
 	if err != nil {
 		return "", 0, err
 	}
 
 	// provider expects ASC
-	providerMsgs := make([]ai.Message, 0, len(recentDesc))
-	for i := len(recentDesc) - 1; i >= 0; i-- {
-		m := recentDesc[i]
-		providerMsgs = append(providerMsgs, ai.Message{Role: m.Role, Content: m.Content})
+	providerMsgs, _, err := s.buildContext(ctx, sess, provider, recentDesc, merged)
+	if err != nil {
+		return "", 0, err
 	}
 
-	reply, err := provider.Chat(ctx, providerMsgs)
+	start := time.Now()
+	resp, err := chat(ctx, provider, ai.ChatRequest{Messages: providerMsgs, Options: merged, ResponseFormat: format})
 	if err != nil {
 		return "", 0, err
 	}
 
-	assistantMsg := &Message{
-		SessionID: sessionID,
-		UserID:    userID,
-		Role:      "assistant",
-		Content:   reply,
-	}
+	assistantMsg := newAssistantMessage(sess, resp.Content, resp.Usage, resp.Backend, time.Since(start))
+	assistantMsg.Reasoning = resp.Reasoning
+	assistantMsg.ToolCalls = resp.ToolCalls
 	if err := s.repo.InsertMessage(ctx, assistantMsg); err != nil {
 		return "", 0, err
 	}
-	return reply, assistantMsg.ID, nil
+	return resp.Content, assistantMsg.ID, nil
 }
 
 func (s *Service) CreateJobOrGetExisting(ctx context.Context, job *Job) (*Job, bool, error) {
 	return s.repo.CreateJobOrGetExisting(ctx, job)
 }
 
-func (s *Service) InsertUserMessageOrGetExisting(ctx context.Context, userID uint64, sessionID string, content string, key *string) (*Message, bool, error) {
-	msg, created, err := s.repo.InsertUserMessageOrGetExisting(ctx, userID, sessionID, content, key)
+func (s *Service) InsertUserMessageOrGetExisting(ctx context.Context, userID uint64, sessionID string, content string, images []ImageInput, key *string) (*Message, bool, error) {
+	userMsg, err := s.newUserMessage(ctx, userID, sessionID, content, images)
+	if err != nil {
+		return nil, false, err
+	}
+	msg, created, err := s.insertUserMessage(ctx, userMsg, key)
 	if err == nil && created {
 		s.maybeSetSessionTitle(ctx, userID, sessionID, content)
 	}
@@ -390,22 +685,23 @@ func makeTitleFromText(content string) string {
 }
 
 func (s *Service) generateTitleWithAI(ctx context.Context, sess *Session, content string) string {
+	ctx = ai.WithAffinity(ctx, sess.SessionID)
 	provider, err := s.providerForSession(ctx, sess)
 	if err != nil {
 		return ""
 	}
 
 	prompt := "Generate a short chat title (max 8 words). Return only the title."
-	msgs := []ai.Message{
+	msgs := withSystemPrompt(sess, []ai.Message{
 		{Role: "system", Content: prompt},
 		{Role: "user", Content: content},
-	}
-	title, err := provider.Chat(ctx, msgs)
+	})
+	resp, err := provider.Chat(ctx, ai.ChatRequest{Messages: msgs})
 	if err != nil {
 		return ""
 	}
 
-	title = strings.TrimSpace(title)
+	title := strings.TrimSpace(resp.Content)
 	title = strings.Trim(title, "\"'`")
 	title = strings.Join(strings.Fields(title), " ")
 	if title == "" {
@@ -2,31 +2,57 @@ package chat
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	gormsqlite "github.com/glebarez/sqlite"
 	"github.com/suPer8Hu/ai-platform/internal/ai"
+	"github.com/suPer8Hu/ai-platform/internal/store/blobstore"
 	"gorm.io/gorm"
 )
 
 type recordingProvider struct {
-	last []ai.Message
+	last      []ai.Message
+	lastTools []ai.Tool
+	lastOpts  ai.GenerationOptions
+	// toolCalls are returned once by the next Chat call
+	toolCalls []ai.ToolCall
 }
 
-func (p *recordingProvider) Chat(ctx context.Context, messages []ai.Message) (string, error) {
+func (p *recordingProvider) Chat(ctx context.Context, req ai.ChatRequest) (ai.ChatResponse, error) {
 	_ = ctx
 	// copy to avoid mutations
-	p.last = append([]ai.Message(nil), messages...)
-	return "ok", nil
+	p.last = append([]ai.Message(nil), req.Messages...)
+	p.lastTools = req.Tools
+	p.lastOpts = req.Options
+	if calls := p.toolCalls; calls != nil {
+		p.toolCalls = nil
+		return ai.ChatResponse{ToolCalls: calls}, nil
+	}
+	return ai.ChatResponse{Content: "ok"}, nil
 }
 
+var testDBs atomic.Int64
+
+// openTestDB opens an in-memory database of the test's own, so runs with
+// -count don't see each other's rows.
 func openTestDB(t *testing.T) *gorm.DB {
 	t.Helper()
-	db, err := gorm.Open(gormsqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	dsn := fmt.Sprintf("file:chattest%d?mode=memory&cache=shared", testDBs.Add(1))
+	db, err := gorm.Open(gormsqlite.Open(dsn), &gorm.Config{})
 	if err != nil {
 		t.Fatalf("open sqlite: %v", err)
 	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
 	if err := db.AutoMigrate(&Session{}, &Message{}); err != nil {
 		t.Fatalf("automigrate: %v", err)
 	}
@@ -48,12 +74,14 @@ func TestSendMessage_WritesUserAndAssistant(t *testing.T) {
 
 	svc := NewService(repo, reg, 20)
 
-	// create session
+	// create session; a title is set so no background title call races the
+	// provider
 	sess := &Session{
 		SessionID: "01TESTSESSIONID00000000000000",
 		UserID:    1,
 		Provider:  "fake",
 		Model:     "default",
+		Title:     "t",
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
@@ -105,11 +133,13 @@ func TestSendMessage_UsesContextWindow(t *testing.T) {
 	window := 3
 	svc := NewService(repo, reg, window)
 
+	// a title is set so no background title call races the provider
 	sess := &Session{
 		SessionID: "01TESTSESSIONID00000000000001",
 		UserID:    2,
 		Provider:  "fake",
 		Model:     "default",
+		Title:     "t",
 	}
 	if err := repo.CreateSession(context.Background(), sess); err != nil {
 		t.Fatalf("create session: %v", err)
@@ -146,3 +176,480 @@ func TestSendMessage_UsesContextWindow(t *testing.T) {
 			prov.last[len(prov.last)-1].Role, prov.last[len(prov.last)-1].Content)
 	}
 }
+
+func TestSend_LoadsHistoryByTokenBudget(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewRepo(db)
+
+	prov := &recordingProvider{}
+	reg := ai.NewRegistry()
+	reg.Register("fake", func(ctx context.Context, model string) (ai.Provider, error) {
+		return prov, nil
+	})
+	// no window size: only the token budget cuts history
+	svc := NewService(repo, reg, 0)
+
+	sess := &Session{SessionID: "01TESTSESSIONID00000000000010", UserID: 10, Provider: "fake", Model: "default", Title: "t"}
+	if err := repo.CreateSession(context.Background(), sess); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	for i := 0; i < 130; i++ {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		if err := repo.InsertMessage(context.Background(), &Message{SessionID: sess.SessionID, UserID: 10, Role: role, Content: fmt.Sprintf("short %d", i)}); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	// many short messages fit the default budget whole
+	if _, err := svc.Send(context.Background(), 10, sess.SessionID, SendInput{Content: "new"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if len(prov.last) != 131 {
+		t.Fatalf("expected the whole history, got %d messages", len(prov.last))
+	}
+
+	// a small budget stops paging once it is full
+	svc.SetTokenBudget(1300, 1000)
+	hist, err := svc.loadHistory(context.Background(), sess, ai.GenerationOptions{})
+	if err != nil {
+		t.Fatalf("load history: %v", err)
+	}
+	if len(hist) != historyPage || hist[0].Role != "assistant" {
+		t.Fatalf("expected one page of history, got %d messages", len(hist))
+	}
+}
+
+func TestSend_PersistsToolCallsAndResults(t *testing.T) {
+	db := openTestDB(t)
+
+	repo := NewRepo(db)
+
+	prov := &recordingProvider{
+		toolCalls: []ai.ToolCall{{ID: "call_1", Name: "get_weather", Arguments: json.RawMessage(`{"city":"Paris"}`)}},
+	}
+	reg := ai.NewRegistry()
+	reg.Register("fake", func(ctx context.Context, model string) (ai.Provider, error) {
+		_ = ctx
+		_ = model
+		return prov, nil
+	})
+
+	svc := NewService(repo, reg, 20)
+
+	// a title is set so no background title call races the provider
+	sess := &Session{
+		SessionID: "01TESTSESSIONID00000000000002",
+		UserID:    3,
+		Provider:  "fake",
+		Model:     "default",
+		Title:     "t",
+	}
+	if err := repo.CreateSession(context.Background(), sess); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+
+	tools := []ai.Tool{{Name: "get_weather", Parameters: json.RawMessage(`{"type":"object"}`)}}
+
+	// 1) model asks for a tool call
+	first, err := svc.Send(context.Background(), 3, sess.SessionID, SendInput{Content: "weather in Paris?", Tools: tools})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if len(first.ToolCalls) != 1 || first.ToolCalls[0].ID != "call_1" {
+		t.Fatalf("expected tool call to be returned, got %+v", first.ToolCalls)
+	}
+	if len(prov.lastTools) != 1 {
+		t.Fatalf("expected tools to reach the provider, got %d", len(prov.lastTools))
+	}
+
+	// 2) client answers with the tool result
+	if _, err := svc.Send(context.Background(), 3, sess.SessionID, SendInput{
+		Tools:       tools,
+		ToolResults: []ToolResult{{ToolCallID: "call_1", Content: `{"temp":21}`}},
+	}); err != nil {
+		t.Fatalf("send tool result: %v", err)
+	}
+
+	// history replayed to the provider: user, assistant(tool call), tool result
+	if len(prov.last) != 3 {
+		t.Fatalf("expected 3 provider messages, got %d", len(prov.last))
+	}
+	call, result := prov.last[1], prov.last[2]
+	if call.Role != "assistant" || len(call.ToolCalls) != 1 || string(call.ToolCalls[0].Arguments) != `{"city":"Paris"}` {
+		t.Fatalf("unexpected replayed tool call: %+v", call)
+	}
+	if result.Role != "tool" || result.ToolCallID != "call_1" || result.Name != "get_weather" {
+		t.Fatalf("unexpected replayed tool result: %+v", result)
+	}
+}
+
+func TestSend_MergesSessionAndMessageOptions(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewRepo(db)
+
+	prov := &recordingProvider{}
+	reg := ai.NewRegistry()
+	reg.Register("fake", func(ctx context.Context, model string) (ai.Provider, error) {
+		return prov, nil
+	})
+	svc := NewService(repo, reg, 20)
+
+	temp, seed := 0.2, 7
+	sess, err := svc.CreateSession(context.Background(), 4, SessionParams{
+		Provider: "fake",
+		Model:    "default",
+		Options:  ai.GenerationOptions{Temperature: &temp, Seed: &seed},
+	})
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	// a title is set so no background title call races the provider
+	if err := repo.UpdateSessionTitleIfEmpty(context.Background(), 4, sess.SessionID, "t"); err != nil {
+		t.Fatalf("set title: %v", err)
+	}
+
+	maxTokens := 64
+	newSeed := 9
+	if err := svc.UpdateSessionOptions(context.Background(), 4, sess.SessionID, ai.GenerationOptions{
+		Temperature: &temp,
+		MaxTokens:   &maxTokens,
+		Seed:        &seed,
+	}); err != nil {
+		t.Fatalf("update options: %v", err)
+	}
+
+	if _, err := svc.Send(context.Background(), 4, sess.SessionID, SendInput{
+		Content: "hi",
+		Options: &ai.GenerationOptions{Seed: &newSeed},
+	}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	got := prov.lastOpts
+	if got.Temperature == nil || *got.Temperature != temp {
+		t.Fatalf("expected session temperature, got %+v", got)
+	}
+	if got.MaxTokens == nil || *got.MaxTokens != maxTokens {
+		t.Fatalf("expected updated max_tokens, got %+v", got)
+	}
+	if got.Seed == nil || *got.Seed != newSeed {
+		t.Fatalf("expected per-message seed override, got %+v", got)
+	}
+}
+
+func TestSend_RebuildsImagesFromHistory(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewRepo(db)
+
+	prov := &recordingProvider{}
+	reg := ai.NewRegistry()
+	reg.Register("fake", func(ctx context.Context, model string) (ai.Provider, error) {
+		return prov, nil
+	})
+	svc := NewService(repo, reg, 20)
+	blobs, err := blobstore.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatalf("blob store: %v", err)
+	}
+	svc.SetBlobStore(blobs)
+
+	sess, err := svc.CreateSession(context.Background(), 5, SessionParams{Provider: "fake", Model: "default"})
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	// a title is set so no background title call races the provider
+	if err := repo.UpdateSessionTitleIfEmpty(context.Background(), 5, sess.SessionID, "t"); err != nil {
+		t.Fatalf("set title: %v", err)
+	}
+
+	png := []byte("\x89PNG\r\n\x1a\nfake")
+	if _, err := svc.Send(context.Background(), 5, sess.SessionID, SendInput{
+		Content: "what is this?",
+		Images:  []ImageInput{{MimeType: "image/png", Data: png}},
+	}); err != nil {
+		t.Fatalf("send image: %v", err)
+	}
+	if _, err := svc.Send(context.Background(), 5, sess.SessionID, SendInput{Content: "and now?"}); err != nil {
+		t.Fatalf("send follow-up: %v", err)
+	}
+
+	// history: user(image), assistant, user
+	if len(prov.last) != 3 {
+		t.Fatalf("expected 3 history messages, got %d", len(prov.last))
+	}
+	imgs := prov.last[0].Images
+	if len(imgs) != 1 || imgs[0].MimeType != "image/png" || string(imgs[0].Data) != string(png) {
+		t.Fatalf("image not rebuilt from history: %+v", imgs)
+	}
+}
+
+func TestUserAttachments_CoverEverySession(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewRepo(db)
+
+	reg := ai.NewRegistry()
+	reg.Register("fake", func(ctx context.Context, model string) (ai.Provider, error) {
+		return &recordingProvider{}, nil
+	})
+	svc := NewService(repo, reg, 20)
+	blobs, err := blobstore.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatalf("blob store: %v", err)
+	}
+	svc.SetBlobStore(blobs)
+
+	for i := 0; i < 2; i++ {
+		sess, err := svc.CreateSession(context.Background(), 9, SessionParams{Provider: "fake", Model: "default"})
+		if err != nil {
+			t.Fatalf("create session: %v", err)
+		}
+		// a title is set so no background title call races the provider
+		if err := repo.UpdateSessionTitleIfEmpty(context.Background(), 9, sess.SessionID, "t"); err != nil {
+			t.Fatalf("set title: %v", err)
+		}
+		if _, err := svc.Send(context.Background(), 9, sess.SessionID, SendInput{
+			Content: "look",
+			Images:  []ImageInput{{MimeType: "image/png", Data: []byte("\x89PNG\r\n\x1a\nfake")}},
+		}); err != nil {
+			t.Fatalf("send image: %v", err)
+		}
+	}
+
+	atts, err := svc.UserAttachments(context.Background(), 9)
+	if err != nil {
+		t.Fatalf("user attachments: %v", err)
+	}
+	if len(atts) != 2 {
+		t.Fatalf("expected an attachment per session, got %+v", atts)
+	}
+	svc.DiscardAttachments(context.Background(), atts)
+	for _, a := range atts {
+		if _, err := blobs.Get(context.Background(), a.Key); !errors.Is(err, blobstore.ErrNotFound) {
+			t.Fatalf("expected blob %s to be gone, got %v", a.Key, err)
+		}
+	}
+}
+
+type scriptedProvider struct {
+	replies []string
+	calls   [][]ai.Message
+}
+
+func (p *scriptedProvider) Chat(ctx context.Context, req ai.ChatRequest) (ai.ChatResponse, error) {
+	_ = ctx
+	p.calls = append(p.calls, req.Messages)
+	reply := p.replies[0]
+	p.replies = p.replies[1:]
+	return ai.ChatResponse{Content: reply, Usage: ai.Usage{PromptTokens: 10, CompletionTokens: 5}}, nil
+}
+
+func TestChat_RepromptsOnceOnInvalidJSON(t *testing.T) {
+	format := &ai.ResponseFormat{
+		Type:   ai.FormatJSONSchema,
+		Schema: json.RawMessage(`{"type":"object","required":["n"],"properties":{"n":{"type":"integer"}}}`),
+		Retry:  true,
+	}
+	prov := &scriptedProvider{replies: []string{`{"n":"one"}`, "```json\n{\"n\": 1}\n```"}}
+
+	resp, err := chat(context.Background(), prov, ai.ChatRequest{
+		Messages:       []ai.Message{{Role: "user", Content: "count"}},
+		ResponseFormat: format,
+	})
+	if err != nil {
+		t.Fatalf("chat: %v", err)
+	}
+	if resp.Content != `{"n":1}` {
+		t.Fatalf("expected compacted JSON, got %q", resp.Content)
+	}
+	if resp.Usage.PromptTokens != 20 || resp.Usage.CompletionTokens != 10 {
+		t.Fatalf("expected usage of both calls, got %+v", resp.Usage)
+	}
+	if len(prov.calls) != 2 || len(prov.calls[1]) != 3 || prov.calls[1][1].Content != `{"n":"one"}` {
+		t.Fatalf("expected re-prompt with the invalid reply, got %+v", prov.calls)
+	}
+
+	format.Retry = false
+	prov = &scriptedProvider{replies: []string{"not json"}}
+	_, err = chat(context.Background(), prov, ai.ChatRequest{ResponseFormat: format})
+	if !errors.Is(err, ai.ErrInvalidJSONOutput) {
+		t.Fatalf("expected ErrInvalidJSONOutput, got %v", err)
+	}
+}
+
+func TestSummary_FoldsDroppedTurnsIntoContext(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewRepo(db)
+
+	prov := &recordingProvider{}
+	reg := ai.NewRegistry()
+	reg.Register("fake", func(ctx context.Context, model string) (ai.Provider, error) {
+		return prov, nil
+	})
+	svc := NewService(repo, reg, 4)
+
+	// a title is set so no background title call races the provider
+	sess := &Session{SessionID: "01TESTSESSIONID00000000000006", UserID: 6, Provider: "fake", Model: "default", Title: "t"}
+	if err := repo.CreateSession(context.Background(), sess); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	for _, content := range []string{"a", "b", "c"} {
+		if _, _, err := svc.SendMessage(context.Background(), 6, sess.SessionID, content); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+
+	// six messages, window of four: the first turn was dropped
+	got, err := svc.UpdateSummary(context.Background(), 6, sess.SessionID)
+	if err != nil {
+		t.Fatalf("update summary: %v", err)
+	}
+	if got.Summary != "ok" || got.SummaryUpdatedAt == nil {
+		t.Fatalf("expected stored summary, got %+v", got)
+	}
+	if len(prov.last) != 2 || !strings.Contains(prov.last[1].Content, "user: a\nassistant: ok\n") {
+		t.Fatalf("unexpected summarizer request: %+v", prov.last)
+	}
+	through := got.SummaryThroughID
+
+	if _, _, err := svc.SendMessage(context.Background(), 6, sess.SessionID, "d"); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if len(prov.last) != 5 || prov.last[0].Role != "system" || prov.last[0].Content != summaryContextPrefix+"ok" {
+		t.Fatalf("expected summary before the window, got %+v", prov.last)
+	}
+
+	// the second turn has now left the window too
+	prov.last = nil
+	got, err = svc.UpdateSummary(context.Background(), 6, sess.SessionID)
+	if err != nil {
+		t.Fatalf("update summary: %v", err)
+	}
+	if got.SummaryThroughID <= through || prov.last == nil {
+		t.Fatalf("expected the next turn to be folded in, got through=%d", got.SummaryThroughID)
+	}
+}
+
+func TestSummary_FoldsTurnsDroppedByTokenBudget(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewRepo(db)
+
+	prov := &recordingProvider{}
+	reg := ai.NewRegistry()
+	reg.Register("fake", func(ctx context.Context, model string) (ai.Provider, error) {
+		return prov, nil
+	})
+	// the window holds every message, but the budget only the last turn
+	svc := NewService(repo, reg, 20)
+	svc.SetTokenBudget(1300, 1000)
+
+	sess := &Session{SessionID: "01TESTSESSIONID00000000000008", UserID: 8, Provider: "fake", Model: "default", Title: "t"}
+	if err := repo.CreateSession(context.Background(), sess); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	for _, c := range []string{"a", "b", "c"} {
+		if _, _, err := svc.SendMessage(context.Background(), 8, sess.SessionID, strings.Repeat(c, 600)); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+
+	got, err := svc.UpdateSummary(context.Background(), 8, sess.SessionID)
+	if err != nil {
+		t.Fatalf("update summary: %v", err)
+	}
+	msgs, err := repo.ListRecentMessagesDesc(context.Background(), 8, sess.SessionID, 20)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	// everything before the last turn (user "c", assistant) is summarized
+	if len(msgs) != 6 || got.SummaryThroughID != msgs[2].ID {
+		t.Fatalf("expected the summary through the second turn, got through=%d", got.SummaryThroughID)
+	}
+	if !strings.Contains(prov.last[1].Content, "user: aaa") || !strings.Contains(prov.last[1].Content, "user: bbb") {
+		t.Fatalf("unexpected summarizer request: %+v", prov.last)
+	}
+}
+
+// summaryCountingProvider answers everything with "ok" and counts summary
+// requests; it is safe to call from the background summary.
+type summaryCountingProvider struct {
+	summaries atomic.Int32
+}
+
+func (p *summaryCountingProvider) Chat(ctx context.Context, req ai.ChatRequest) (ai.ChatResponse, error) {
+	if len(req.Messages) > 0 && req.Messages[0].Content == summaryPrompt {
+		p.summaries.Add(1)
+	}
+	return ai.ChatResponse{Content: "ok"}, nil
+}
+
+func TestSend_UpdatesSummaryInBackground(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewRepo(db)
+
+	prov := &summaryCountingProvider{}
+	reg := ai.NewRegistry()
+	reg.Register("fake", func(ctx context.Context, model string) (ai.Provider, error) {
+		return prov, nil
+	})
+	svc := NewService(repo, reg, 4)
+	svc.SetBackgroundSummaries(true)
+
+	sess := &Session{SessionID: "01TESTSESSIONID00000000000011", UserID: 11, Provider: "fake", Model: "default", Title: "t"}
+	if err := repo.CreateSession(context.Background(), sess); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	for _, content := range []string{"a", "b", "c"} {
+		if _, err := svc.Send(context.Background(), 11, sess.SessionID, SendInput{Content: content}); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+
+	// six messages, window of four: the first turn gets summarized
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := svc.GetSummary(context.Background(), 11, sess.SessionID)
+		if err != nil {
+			t.Fatalf("get summary: %v", err)
+		}
+		if got.Summary == "ok" && got.SummaryThroughID > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("summary was not updated, got %+v", got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if prov.summaries.Load() == 0 {
+		t.Fatalf("expected a summary request")
+	}
+}
+
+func TestSend_InjectsSystemPromptFirst(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewRepo(db)
+
+	prov := &recordingProvider{}
+	reg := ai.NewRegistry()
+	reg.Register("fake", func(ctx context.Context, model string) (ai.Provider, error) {
+		return prov, nil
+	})
+	svc := NewService(repo, reg, 20)
+
+	sess, err := svc.CreateSession(context.Background(), 7, SessionParams{Provider: "fake", Model: "default", SystemPrompt: "You are terse."})
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	if err := repo.UpdateSessionTitle(context.Background(), 7, sess.SessionID, "t"); err != nil {
+		t.Fatalf("set title: %v", err)
+	}
+
+	if _, _, err := svc.SendMessage(context.Background(), 7, sess.SessionID, "hi"); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if len(prov.last) != 2 || prov.last[0].Role != "system" || prov.last[0].Content != "You are terse." {
+		t.Fatalf("expected system prompt first, got %+v", prov.last)
+	}
+}
@@ -0,0 +1,191 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/suPer8Hu/ai-platform/internal/ai"
+	"gorm.io/gorm"
+)
+
+const (
+	// summaryTimeout bounds a background summary update.
+	summaryTimeout = 2 * time.Minute
+	// summaryBatch is the number of dropped messages folded in per model call.
+	summaryBatch = 60
+	// summaryMessageTokens caps each message quoted to the summarizer.
+	summaryMessageTokens = 1000
+)
+
+const summaryPrompt = "You keep a running summary of a conversation between a user and an assistant. " +
+	"Merge the new messages into the current summary. Keep facts, names, numbers, decisions, " +
+	"user preferences and open questions; drop greetings and small talk. " +
+	"Write at most 300 words, in the language of the conversation. Return only the summary."
+
+// summaryContextPrefix introduces the summary in provider context.
+const summaryContextPrefix = "Summary of the earlier conversation:\n"
+
+// GetSummary returns the session, whose Summary fields hold its summary.
+func (s *Service) GetSummary(ctx context.Context, userID uint64, sessionID string) (*Session, error) {
+	sess, err := s.repo.GetSessionBySessionID(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if sess.UserID != userID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return sess, nil
+}
+
+// UpdateSummary folds the turns that fell out of the context window since the
+// last update into the session's summary. It is cheap when nothing new was
+// dropped.
+func (s *Service) UpdateSummary(ctx context.Context, userID uint64, sessionID string) (*Session, error) {
+	return s.summarize(ctx, userID, sessionID, false)
+}
+
+// SetBackgroundSummaries makes Send and SendMessageStream fold dropped turns
+// into the session summary after each reply, in the background. Async jobs
+// update it in the worker instead.
+func (s *Service) SetBackgroundSummaries(on bool) {
+	s.backgroundSummaries = on
+}
+
+// updateSummaryInBackground runs UpdateSummary with its own timeout, once at
+// a time per session; the reply is already stored, so failures only get
+// logged.
+func (s *Service) updateSummaryInBackground(userID uint64, sessionID string) {
+	if !s.backgroundSummaries {
+		return
+	}
+	if _, running := s.summarizing.LoadOrStore(sessionID, struct{}{}); running {
+		return
+	}
+	go func() {
+		defer s.summarizing.Delete(sessionID)
+		ctx, cancel := context.WithTimeout(context.Background(), summaryTimeout)
+		defer cancel()
+		if _, err := s.UpdateSummary(ctx, userID, sessionID); err != nil {
+			log.Printf("chat: summary session=%s err=%v", sessionID, err)
+		}
+	}()
+}
+
+// RegenerateSummary rebuilds the session's summary from every turn outside
+// the context window.
+func (s *Service) RegenerateSummary(ctx context.Context, userID uint64, sessionID string) (*Session, error) {
+	return s.summarize(ctx, userID, sessionID, true)
+}
+
+func (s *Service) summarize(ctx context.Context, userID uint64, sessionID string, fresh bool) (*Session, error) {
+	ctx = ai.WithAffinity(ctx, sessionID)
+	sess, err := s.GetSummary(ctx, userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := s.providerForSession(ctx, sess)
+	if err != nil {
+		return nil, err
+	}
+
+	// the oldest message the next reply's context keeps; everything before
+	// it was dropped by the token budget
+	recentDesc, err := s.loadHistory(ctx, sess, sess.Options)
+	if err != nil {
+		return nil, err
+	}
+	_, windowStart, err := s.buildContext(ctx, sess, provider, recentDesc, sess.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	summary, through := sess.Summary, sess.SummaryThroughID
+	if fresh {
+		summary, through = "", 0
+	}
+	for {
+		batch, err := s.repo.ListMessagesBetween(ctx, userID, sessionID, through, windowStart, summaryBatch)
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		if summary, err = foldSummary(ctx, provider, summary, batch); err != nil {
+			return nil, err
+		}
+		through = batch[len(batch)-1].ID
+	}
+	if !fresh && through == sess.SummaryThroughID {
+		return sess, nil
+	}
+
+	// when another worker got there first, its summary is kept
+	if err := s.repo.UpdateSessionSummary(ctx, userID, sessionID, summary, through, sess.SummaryThroughID); err != nil {
+		return nil, err
+	}
+	return s.GetSummary(ctx, userID, sessionID)
+}
+
+// foldSummary asks the model to merge msgs (ASC) into summary.
+func foldSummary(ctx context.Context, provider ai.Provider, summary string, msgs []Message) (string, error) {
+	var b strings.Builder
+	b.WriteString("Current summary:\n")
+	if summary == "" {
+		b.WriteString("(none)")
+	} else {
+		b.WriteString(summary)
+	}
+	b.WriteString("\n\nNew messages:\n")
+	tok := ai.HeuristicTokenizer{}
+	for _, m := range msgs {
+		content := ai.TruncateToTokens(tok, m.Content, summaryMessageTokens, truncatedMarker)
+		switch {
+		case m.Role == "tool":
+			fmt.Fprintf(&b, "tool result (%s): %s\n", m.ToolName, content)
+		case len(m.ToolCalls) > 0:
+			for _, tc := range m.ToolCalls {
+				fmt.Fprintf(&b, "assistant called %s(%s)\n", tc.Name, tc.Arguments)
+			}
+			if content != "" {
+				fmt.Fprintf(&b, "assistant: %s\n", content)
+			}
+		default:
+			if len(m.Attachments) > 0 {
+				content = fmt.Sprintf("%s [%d image(s)]", content, len(m.Attachments))
+			}
+			fmt.Fprintf(&b, "%s: %s\n", m.Role, content)
+		}
+	}
+
+	resp, err := provider.Chat(ctx, ai.ChatRequest{Messages: []ai.Message{
+		{Role: "system", Content: summaryPrompt},
+		{Role: "user", Content: b.String()},
+	}})
+	if err != nil {
+		return "", err
+	}
+	out := strings.TrimSpace(resp.Content)
+	if out == "" {
+		return "", errors.New("chat: summarizer returned an empty summary")
+	}
+	return out, nil
+}
+
+// withSummary drops the messages the session's summary already covers and
+// puts the summary in front as a system message.
+func withSummary(sess *Session, recentDesc []Message) ([]Message, *ai.Message) {
+	if sess.Summary == "" {
+		return recentDesc, nil
+	}
+	n := len(recentDesc)
+	for n > 0 && recentDesc[n-1].ID <= sess.SummaryThroughID {
+		n--
+	}
+	return recentDesc[:n], &ai.Message{Role: "system", Content: summaryContextPrefix + sess.Summary}
+}
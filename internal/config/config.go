@@ -4,8 +4,18 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// OpenAIBackend is one named OpenAI-compatible server (vLLM, llama.cpp, LM Studio, ...).
+type OpenAIBackend struct {
+	Name    string
+	BaseURL string
+	APIKey  string
+	Model   string
+}
+
 type Config struct {
 	DBDSN         string
 	JWTSecret     string
@@ -21,14 +31,67 @@ type Config struct {
 	ChatContextWindowSize int
 
 	// AI provider
-	AIProvider         string
-	OllamaBaseURL      string
+	AIProvider      string
+	AIFallbackChain string
+	// AIProvidersFile declares the provider backends in YAML or JSON; when
+	// set it replaces the per-provider env vars below
+	AIProvidersFile string
+	OllamaBaseURL   string
+	// OllamaBaseURLs are all configured nodes; more than one makes a pool
+	OllamaBaseURLs     []string
 	OllamaModel        string
 	OpenRouterBaseURL  string
 	OpenRouterAPIKey   string
 	OpenRouterModel    string
 	OpenRouterSiteURL  string
 	OpenRouterAppName  string
+	OpenAIBackends     []OpenAIBackend
+	AnthropicBaseURL   string
+	AnthropicAPIKey    string
+	AnthropicModel     string
+	AnthropicMaxTokens int
+	GeminiBaseURL      string
+	GeminiAPIKey       string
+	GeminiModel        string
+
+	// circuit breaker per provider backend
+	AIBreakerFailures int
+	AIBreakerCooldown time.Duration
+
+	// transport-level retries of provider calls
+	AIRetryMaxAttempts int
+	AIRetryBaseDelay   time.Duration
+	AIRetryMaxDelay    time.Duration
+
+	// concurrent requests per provider backend in this process; 0 means
+	// unlimited. Up to AIMaxQueue more wait for AIQueueTimeout.
+	AIMaxConcurrent int
+	AIMaxQueue      int
+	AIQueueTimeout  time.Duration
+
+	// token budget of the context sent to a model: AIContextTokens is assumed
+	// when the model's context length is unknown, AIReplyReserveTokens is kept
+	// for the reply when the request has no max_tokens
+	AIContextTokens      int
+	AIReplyReserveTokens int
+
+	// AIEmbedModel is used by /embeddings when the request names no model
+	AIEmbedModel string
+
+	// AIModelsCacheTTL is how long discovered model lists are cached
+	AIModelsCacheTTL time.Duration
+
+	// replay provider: "record" proxies to AIReplayUpstream and writes
+	// cassettes to AIReplayDir, "replay" serves them offline
+	AIReplayMode     string
+	AIReplayDir      string
+	AIReplayUpstream string
+
+	// BlobDir stores chat image attachments; empty disables them
+	BlobDir string
+
+	// AdminUserIDs may call /admin endpoints
+	AdminUserIDs []uint64
 
 	// rabbitMQ
 	RabbitURL   string
@@ -74,7 +137,9 @@ func Load() Config {
 		smtpFrom = os.Getenv("SMTP_USER")
 	}
 
-	windowSize := 20
+	// a cap on the history messages per reply; the token budget decides, and
+	// 0 leaves only the built-in safety cap
+	windowSize := 0
 	if v := os.Getenv("CHAT_CONTEXT_WINDOW_SIZE"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil {
 			windowSize = n
@@ -87,10 +152,17 @@ func Load() Config {
 		aiProvider = "ollama"
 	}
 
-	ollamaBaseURL := os.Getenv("OLLAMA_BASE_URL")
-	if ollamaBaseURL == "" {
-		ollamaBaseURL = "http://localhost:11434"
+	// OLLAMA_BASE_URL may list several nodes, comma separated
+	var ollamaBaseURLs []string
+	for _, u := range strings.Split(os.Getenv("OLLAMA_BASE_URL"), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			ollamaBaseURLs = append(ollamaBaseURLs, u)
+		}
 	}
+	if len(ollamaBaseURLs) == 0 {
+		ollamaBaseURLs = []string{"http://localhost:11434"}
+	}
+	ollamaBaseURL := ollamaBaseURLs[0]
 
 	ollamaModel := os.Getenv("OLLAMA_MODEL")
 	if ollamaModel == "" {
@@ -106,6 +178,148 @@ func Load() Config {
 		openRouterModel = "openrouter/auto"
 	}
 
+	// OPENAI_BACKENDS=vllm,lmstudio -> OPENAI_VLLM_BASE_URL, OPENAI_VLLM_API_KEY, OPENAI_VLLM_MODEL, ...
+	var openAIBackends []OpenAIBackend
+	for _, name := range strings.Split(os.Getenv("OPENAI_BACKENDS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OPENAI_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		openAIBackends = append(openAIBackends, OpenAIBackend{
+			Name:    name,
+			BaseURL: os.Getenv(prefix + "BASE_URL"),
+			APIKey:  os.Getenv(prefix + "API_KEY"),
+			Model:   os.Getenv(prefix + "MODEL"),
+		})
+	}
+
+	anthropicBaseURL := os.Getenv("ANTHROPIC_BASE_URL")
+	if anthropicBaseURL == "" {
+		anthropicBaseURL = "https://api.anthropic.com"
+	}
+	anthropicModel := os.Getenv("ANTHROPIC_MODEL")
+	if anthropicModel == "" {
+		anthropicModel = "claude-sonnet-4-5"
+	}
+	anthropicMaxTokens := 4096
+	if v := os.Getenv("ANTHROPIC_MAX_TOKENS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			anthropicMaxTokens = n
+		}
+	}
+
+	geminiBaseURL := os.Getenv("GEMINI_BASE_URL")
+	if geminiBaseURL == "" {
+		geminiBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+	}
+	geminiModel := os.Getenv("GEMINI_MODEL")
+	if geminiModel == "" {
+		geminiModel = "gemini-2.5-flash"
+	}
+
+	breakerFailures := 5
+	if v := os.Getenv("AI_BREAKER_FAILURES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			breakerFailures = n
+		}
+	}
+	breakerCooldown := 30 * time.Second
+	if v := os.Getenv("AI_BREAKER_COOLDOWN"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			breakerCooldown = d
+		}
+	}
+
+	retryMaxAttempts := 3
+	if v := os.Getenv("AI_RETRY_MAX_ATTEMPTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			retryMaxAttempts = n
+		}
+	}
+	retryBaseDelay := 200 * time.Millisecond
+	if v := os.Getenv("AI_RETRY_BASE_DELAY"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			retryBaseDelay = d
+		}
+	}
+	retryMaxDelay := 5 * time.Second
+	if v := os.Getenv("AI_RETRY_MAX_DELAY"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			retryMaxDelay = d
+		}
+	}
+
+	maxConcurrent := 0
+	if v := os.Getenv("AI_MAX_CONCURRENT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			maxConcurrent = n
+		}
+	}
+	maxQueue := 64
+	if v := os.Getenv("AI_MAX_QUEUE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			maxQueue = n
+		}
+	}
+	queueTimeout := 30 * time.Second
+	if v := os.Getenv("AI_QUEUE_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			queueTimeout = d
+		}
+	}
+
+	contextTokens := 8192
+	if v := os.Getenv("AI_CONTEXT_TOKENS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			contextTokens = n
+		}
+	}
+	replyReserveTokens := 1024
+	if v := os.Getenv("AI_REPLY_RESERVE_TOKENS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			replyReserveTokens = n
+		}
+	}
+
+	embedModel := os.Getenv("AI_EMBED_MODEL")
+	if embedModel == "" {
+		embedModel = "nomic-embed-text"
+	}
+
+	modelsCacheTTL := 5 * time.Minute
+	if v := os.Getenv("AI_MODELS_CACHE_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			modelsCacheTTL = d
+		}
+	}
+
+	replayMode := os.Getenv("AI_REPLAY_MODE")
+	if replayMode == "" {
+		replayMode = "replay"
+	}
+	replayDir := os.Getenv("AI_REPLAY_DIR")
+	if replayDir == "" {
+		replayDir = "testdata/cassettes"
+	}
+	replayUpstream := os.Getenv("AI_REPLAY_UPSTREAM")
+	if replayUpstream == "" {
+		replayUpstream = "ollama"
+	}
+
+	blobDir, ok := os.LookupEnv("BLOB_DIR")
+	if !ok {
+		blobDir = "data/blobs"
+	}
+
+	// ADMIN_USER_IDS=1,42
+	var adminUserIDs []uint64
+	for _, v := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		if n, err := strconv.ParseUint(strings.TrimSpace(v), 10, 64); err == nil {
+			adminUserIDs = append(adminUserIDs, n)
+		}
+	}
+
 	// rabbitMQ config
 	rabbitURL := os.Getenv("RABBIT_URL")
 	if rabbitURL == "" {
@@ -131,14 +345,51 @@ func Load() Config {
 		SMTPFrom:              smtpFrom,
 		ChatContextWindowSize: windowSize,
 
-		AIProvider:        aiProvider,
-		OllamaBaseURL:     ollamaBaseURL,
-		OllamaModel:       ollamaModel,
-		OpenRouterBaseURL: openRouterBaseURL,
-		OpenRouterAPIKey:  os.Getenv("OPENROUTER_API_KEY"),
-		OpenRouterModel:   openRouterModel,
-		OpenRouterSiteURL: os.Getenv("OPENROUTER_SITE_URL"),
-		OpenRouterAppName: os.Getenv("OPENROUTER_APP_NAME"),
+		AIProvider:         aiProvider,
+		AIFallbackChain:    os.Getenv("AI_FALLBACK_CHAIN"), // e.g. "ollama:llama3:latest,openrouter:openrouter/auto"
+		AIProvidersFile:    strings.TrimSpace(os.Getenv("AI_PROVIDERS_FILE")),
+		OllamaBaseURL:      ollamaBaseURL,
+		OllamaBaseURLs:     ollamaBaseURLs,
+		OllamaModel:        ollamaModel,
+		OpenRouterBaseURL:  openRouterBaseURL,
+		OpenRouterAPIKey:   os.Getenv("OPENROUTER_API_KEY"),
+		OpenRouterModel:    openRouterModel,
+		OpenRouterSiteURL:  os.Getenv("OPENROUTER_SITE_URL"),
+		OpenRouterAppName:  os.Getenv("OPENROUTER_APP_NAME"),
+		OpenAIBackends:     openAIBackends,
+		AnthropicBaseURL:   anthropicBaseURL,
+		AnthropicAPIKey:    os.Getenv("ANTHROPIC_API_KEY"),
+		AnthropicModel:     anthropicModel,
+		AnthropicMaxTokens: anthropicMaxTokens,
+		GeminiBaseURL:      geminiBaseURL,
+		GeminiAPIKey:       os.Getenv("GEMINI_API_KEY"),
+		GeminiModel:        geminiModel,
+
+		AIBreakerFailures: breakerFailures,
+		AIBreakerCooldown: breakerCooldown,
+
+		AIRetryMaxAttempts: retryMaxAttempts,
+		AIRetryBaseDelay:   retryBaseDelay,
+		AIRetryMaxDelay:    retryMaxDelay,
+
+		AIMaxConcurrent: maxConcurrent,
+		AIMaxQueue:      maxQueue,
+		AIQueueTimeout:  queueTimeout,
+
+		AIContextTokens:      contextTokens,
+		AIReplyReserveTokens: replyReserveTokens,
+
+		AIEmbedModel: embedModel,
+
+		AIModelsCacheTTL: modelsCacheTTL,
+
+		AIReplayMode:     replayMode,
+		AIReplayDir:      replayDir,
+		AIReplayUpstream: replayUpstream,
+
+		BlobDir: blobDir,
+
+		AdminUserIDs: adminUserIDs,
 
 		RabbitURL:   rabbitURL,
 		RabbitQueue: rabbitQueue,
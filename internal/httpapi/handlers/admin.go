@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/suPer8Hu/ai-platform/internal/ai"
+)
+
+// ProviderHealth lists the circuit breaker and limiter state of every backend
+// contacted so far.
+func (h *Handler) ProviderHealth(c *gin.Context) {
+	ok(c, gin.H{"providers": h.Breakers.Status(), "limiters": h.Limiters.Status()})
+}
+
+// defaultKeepAlive is how long a preloaded model stays loaded when the
+// request doesn't say.
+const defaultKeepAlive = 30 * time.Minute
+
+// ollamaNodes resolves a "node" parameter to the base URLs of the ollama
+// backends it names: that one node, or every node when empty.
+func (h *Handler) ollamaNodes(c *gin.Context, node string) ([]string, bool) {
+	node = strings.TrimRight(strings.TrimSpace(node), "/")
+	all := h.Providers.OllamaNodes()
+	if len(all) == 0 {
+		fail(c, http.StatusBadRequest, 10002, "no ollama backend configured")
+		return nil, false
+	}
+	if node == "" {
+		return all, true
+	}
+	for _, n := range all {
+		if strings.TrimRight(n, "/") == node {
+			return []string{n}, true
+		}
+	}
+	fail(c, http.StatusBadRequest, 10002, "unknown ollama node")
+	return nil, false
+}
+
+// invalidateOllamaModels drops the catalog of every ollama backend, whatever
+// its name.
+func (h *Handler) invalidateOllamaModels() {
+	for _, name := range h.Providers.OllamaBackends() {
+		h.Models.Invalidate(name)
+	}
+}
+
+func validModelName(c *gin.Context, model string) (string, bool) {
+	model = strings.TrimSpace(model)
+	if model == "" {
+		fail(c, http.StatusBadRequest, 10002, "model required")
+		return "", false
+	}
+	if len(model) > 256 {
+		fail(c, http.StatusBadRequest, 10002, "model too long")
+		return "", false
+	}
+	return model, true
+}
+
+// eachNode runs fn on every node concurrently and returns the results in
+// node order.
+func eachNode(nodes []string, fn func(node *ai.OllamaProvider) gin.H) []gin.H {
+	out := make([]gin.H, len(nodes))
+	var wg sync.WaitGroup
+	for i, n := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := fn(ai.NewOllamaProvider(n, ""))
+			res["node"] = n
+			out[i] = res
+		}()
+	}
+	wg.Wait()
+	return out
+}
+
+// ListOllamaModels shows the pulled and the loaded models of each node.
+func (h *Handler) ListOllamaModels(c *gin.Context) {
+	nodes, okk := h.ollamaNodes(c, c.Query("node"))
+	if !okk {
+		return
+	}
+	ctx := c.Request.Context()
+	ok(c, gin.H{"nodes": eachNode(nodes, func(p *ai.OllamaProvider) gin.H {
+		models, err := p.ListModels(ctx)
+		if err != nil {
+			return gin.H{"error": err.Error()}
+		}
+		running, err := p.RunningModels(ctx)
+		if err != nil {
+			return gin.H{"models": models, "error": err.Error()}
+		}
+		return gin.H{"models": models, "running": running}
+	})})
+}
+
+// ShowOllamaModel returns the details of a model from the first node that has it.
+func (h *Handler) ShowOllamaModel(c *gin.Context) {
+	model, okk := validModelName(c, c.Query("model"))
+	if !okk {
+		return
+	}
+	nodes, okk := h.ollamaNodes(c, c.Query("node"))
+	if !okk {
+		return
+	}
+
+	var lastErr error
+	for _, n := range nodes {
+		info, err := ai.NewOllamaProvider(n, "").ShowModel(c.Request.Context(), model)
+		if err == nil {
+			ok(c, gin.H{"node": n, "model": model, "info": info})
+			return
+		}
+		lastErr = err
+	}
+	if errors.Is(lastErr, ai.ErrModelNotFound) {
+		fail(c, http.StatusNotFound, 40404, "model not found")
+		return
+	}
+	fail(c, http.StatusBadGateway, 50202, lastErr.Error())
+}
+
+// PullOllamaModel pulls a model on the chosen nodes one after the other,
+// streaming Ollama's progress as SSE "progress" events. A node that fails
+// gets an "error" event and the pull moves on; "done" lists the outcome.
+func (h *Handler) PullOllamaModel(c *gin.Context) {
+	var req struct {
+		Model string `json:"model"`
+		Node  string `json:"node"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, http.StatusBadRequest, 10001, "invalid json")
+		return
+	}
+	model, okk := validModelName(c, req.Model)
+	if !okk {
+		return
+	}
+	nodes, okk := h.ollamaNodes(c, req.Node)
+	if !okk {
+		return
+	}
+
+	ctx := c.Request.Context()
+	sse := startSSE(c)
+	if sse == nil {
+		return
+	}
+	defer sse.close()
+
+	pulled, failed := []string{}, []string{}
+	for _, n := range nodes {
+		var pullErr error
+		for pr, err := range ai.NewOllamaProvider(n, "").PullModel(ctx, model) {
+			if err != nil {
+				pullErr = err
+				break
+			}
+			sse.send("progress", gin.H{
+				"type":      "progress",
+				"node":      n,
+				"status":    pr.Status,
+				"digest":    pr.Digest,
+				"total":     pr.Total,
+				"completed": pr.Completed,
+			})
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if pullErr != nil {
+			sse.send("error", gin.H{
+				"type":    "error",
+				"node":    n,
+				"message": pullErr.Error(),
+			})
+			failed = append(failed, n)
+			continue
+		}
+		pulled = append(pulled, n)
+	}
+
+	// new models show up in the catalog right away
+	h.invalidateOllamaModels()
+	sse.send("done", gin.H{
+		"type":   "done",
+		"model":  model,
+		"pulled": pulled,
+		"failed": failed,
+	})
+}
+
+// DeleteOllamaModel removes a model from the chosen nodes.
+func (h *Handler) DeleteOllamaModel(c *gin.Context) {
+	model, okk := validModelName(c, c.Query("model"))
+	if !okk {
+		return
+	}
+	nodes, okk := h.ollamaNodes(c, c.Query("node"))
+	if !okk {
+		return
+	}
+
+	ctx := c.Request.Context()
+	results := eachNode(nodes, func(p *ai.OllamaProvider) gin.H {
+		if err := p.DeleteModel(ctx, model); err != nil {
+			return gin.H{"deleted": false, "error": err.Error()}
+		}
+		return gin.H{"deleted": true}
+	})
+	h.invalidateOllamaModels()
+	ok(c, gin.H{"model": model, "nodes": results})
+}
+
+// PreloadOllamaModel loads a model on the chosen nodes ahead of traffic.
+// keep_alive is a duration such as "4h"; "-1" keeps the model loaded until
+// the node restarts and "0" unloads it.
+func (h *Handler) PreloadOllamaModel(c *gin.Context) {
+	var req struct {
+		Model     string `json:"model"`
+		Node      string `json:"node"`
+		KeepAlive string `json:"keep_alive"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, http.StatusBadRequest, 10001, "invalid json")
+		return
+	}
+	model, okk := validModelName(c, req.Model)
+	if !okk {
+		return
+	}
+	nodes, okk := h.ollamaNodes(c, req.Node)
+	if !okk {
+		return
+	}
+	keepAlive := defaultKeepAlive
+	ka := strings.TrimSpace(req.KeepAlive)
+	switch ka {
+	case "":
+		ka = defaultKeepAlive.String()
+	case "-1":
+		keepAlive = -1
+	default:
+		d, err := time.ParseDuration(ka)
+		if err != nil || d < 0 {
+			fail(c, http.StatusBadRequest, 10002, "invalid keep_alive")
+			return
+		}
+		keepAlive = d
+	}
+
+	ctx := c.Request.Context()
+	results := eachNode(nodes, func(p *ai.OllamaProvider) gin.H {
+		if err := p.Preload(ctx, model, keepAlive); err != nil {
+			return gin.H{"loaded": false, "error": err.Error()}
+		}
+		return gin.H{"loaded": keepAlive != 0}
+	})
+	ok(c, gin.H{"model": model, "keep_alive": ka, "nodes": results})
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/suPer8Hu/ai-platform/internal/chat"
+)
+
+const (
+	maxImagesPerMessage = 4
+	maxImageBytes       = 5 << 20
+)
+
+var allowedImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// imageReq is an image sent inline in a JSON body.
+type imageReq struct {
+	Data []byte `json:"data"` // base64
+}
+
+// bindMessageRequest decodes a JSON body, or a multipart form whose fields
+// match the `form` tags of req. Files uploaded as "images" are returned.
+func bindMessageRequest(c *gin.Context, req any) ([]imageReq, error) {
+	if c.ContentType() != binding.MIMEMultipartPOSTForm {
+		return nil, c.ShouldBindJSON(req)
+	}
+	if err := c.ShouldBindWith(req, binding.FormMultipart); err != nil {
+		return nil, err
+	}
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, err
+	}
+	var out []imageReq
+	for _, fh := range form.File["images"] {
+		if fh.Size > maxImageBytes {
+			return nil, fmt.Errorf("image %q is larger than %d bytes", fh.Filename, maxImageBytes)
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(io.LimitReader(f, maxImageBytes+1))
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, imageReq{Data: data})
+	}
+	return out, nil
+}
+
+// validImages checks count, size and type of the uploaded images, replying
+// 400 on failure. The type is sniffed from the bytes, not taken from the client.
+func (h *Handler) validImages(c *gin.Context, images []imageReq) ([]chat.ImageInput, bool) {
+	if len(images) == 0 {
+		return nil, true
+	}
+	if !h.ChatSvc.AttachmentsEnabled() {
+		fail(c, http.StatusBadRequest, 10004, "image attachments are disabled")
+		return nil, false
+	}
+	if len(images) > maxImagesPerMessage {
+		fail(c, http.StatusBadRequest, 10004, fmt.Sprintf("at most %d images per message", maxImagesPerMessage))
+		return nil, false
+	}
+	out := make([]chat.ImageInput, 0, len(images))
+	for _, img := range images {
+		if len(img.Data) == 0 || len(img.Data) > maxImageBytes {
+			fail(c, http.StatusBadRequest, 10004, "image is empty or too large")
+			return nil, false
+		}
+		mime := http.DetectContentType(img.Data)
+		if !allowedImageTypes[mime] {
+			fail(c, http.StatusBadRequest, 10004, "unsupported image type "+mime)
+			return nil, false
+		}
+		out = append(out, chat.ImageInput{MimeType: mime, Data: img.Data})
+	}
+	return out, true
+}
@@ -2,8 +2,9 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
@@ -11,6 +12,7 @@ import (
 	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
+	"github.com/suPer8Hu/ai-platform/internal/ai"
 	"github.com/suPer8Hu/ai-platform/internal/chat"
 	"github.com/suPer8Hu/ai-platform/internal/common"
 	"github.com/suPer8Hu/ai-platform/internal/httpapi/middleware"
@@ -43,8 +45,35 @@ func userIDFromContext(c *gin.Context) (uint64, bool) {
 }
 
 type createSessionReq struct {
-	Provider string `json:"provider"`
-	Model    string `json:"model"`
+	Provider string                `json:"provider"`
+	Model    string                `json:"model"`
+	Options  *ai.GenerationOptions `json:"options"`
+	// FallbackChain replaces the global AI_FALLBACK_CHAIN for this session.
+	FallbackChain []ai.Backend `json:"fallback_chain"`
+	// PersonaID presets the system prompt, backend and options; the other
+	// fields override it.
+	PersonaID    *uint64 `json:"persona_id"`
+	SystemPrompt *string `json:"system_prompt"`
+}
+
+// defaultModel returns the configured default model of a provider, or "" when unknown.
+func (h *Handler) defaultModel(provider string) string {
+	return h.Providers.DefaultModel(provider)
+}
+
+// validBackend reports a 400 for an unregistered provider or a model its
+// provider doesn't list or allow.
+func (h *Handler) validBackend(c *gin.Context, provider, model string) bool {
+	err := h.Models.Check(c.Request.Context(), provider, model)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ai.ErrUnknownModel):
+		fail(c, http.StatusBadRequest, 40011, err.Error())
+	default:
+		fail(c, http.StatusBadRequest, 10002, err.Error())
+	}
+	return false
 }
 
 func (h *Handler) CreateChatSession(c *gin.Context) {
@@ -57,21 +86,74 @@ func (h *Handler) CreateChatSession(c *gin.Context) {
 	var req createSessionReq
 	_ = c.ShouldBindJSON(&req) // allow empty {}
 
+	var persona chat.Persona
+	if req.PersonaID != nil {
+		p, err := h.ChatSvc.GetPersona(c.Request.Context(), uid, *req.PersonaID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, http.StatusNotFound, 40403, "persona not found")
+				return
+			}
+			fail(c, http.StatusInternalServerError, 50009, "failed to get persona")
+			return
+		}
+		persona = *p
+	}
+
 	provider := strings.TrimSpace(req.Provider)
 	model := strings.TrimSpace(req.Model)
+	if provider == "" && persona.Provider != "" {
+		provider = persona.Provider
+		if model == "" {
+			model = persona.Model
+		}
+	}
 	if provider == "" {
 		provider = h.Cfg.AIProvider
 	}
 	if model == "" {
-		switch strings.ToLower(provider) {
-		case "openrouter":
-			model = h.Cfg.OpenRouterModel
-		case "ollama", "":
-			model = h.Cfg.OllamaModel
+		model = h.defaultModel(provider)
+	}
+
+	if !h.validBackend(c, provider, model) {
+		return
+	}
+
+	params := chat.SessionParams{
+		Provider:     provider,
+		Model:        model,
+		Options:      persona.Options,
+		SystemPrompt: persona.SystemPrompt,
+		PersonaID:    req.PersonaID,
+	}
+	if req.Options != nil {
+		if err := req.Options.Validate(); err != nil {
+			fail(c, http.StatusBadRequest, 10002, err.Error())
+			return
 		}
+		params.Options = params.Options.Merge(req.Options)
+	}
+	if req.SystemPrompt != nil {
+		prompt, okk := validSystemPrompt(c, *req.SystemPrompt)
+		if !okk {
+			return
+		}
+		params.SystemPrompt = prompt
+	}
+	for _, b := range req.FallbackChain {
+		b.Provider = strings.ToLower(strings.TrimSpace(b.Provider))
+		if b.Provider == "" {
+			fail(c, http.StatusBadRequest, 10002, "fallback provider required")
+			return
+		}
+		b.Model = strings.TrimSpace(b.Model)
+		if !h.validBackend(c, b.Provider, b.Model) {
+			return
+		}
+		params.FallbackChain = append(params.FallbackChain, b)
 	}
 
-	sess, err := h.ChatSvc.CreateSession(c.Request.Context(), uid, provider, model)
+	sess, err := h.ChatSvc.CreateSession(c.Request.Context(), uid, params)
 	if err != nil {
 		fail(c, http.StatusInternalServerError, 50001, "failed to create session")
 		return
@@ -113,11 +195,14 @@ func (h *Handler) ListChatSessions(c *gin.Context) {
 	})
 }
 
-type updateSessionTitleReq struct {
-	Title string `json:"title"`
+// updateSessionReq changes the title and/or the default generation options
+// of a session. Options replace the stored ones as a whole.
+type updateSessionReq struct {
+	Title   *string               `json:"title"`
+	Options *ai.GenerationOptions `json:"options"`
 }
 
-func (h *Handler) UpdateChatSessionTitle(c *gin.Context) {
+func (h *Handler) UpdateChatSession(c *gin.Context) {
 	uid, okk := userIDFromContext(c)
 	if !okk {
 		fail(c, http.StatusUnauthorized, 40101, "unauthorized")
@@ -130,32 +215,60 @@ func (h *Handler) UpdateChatSessionTitle(c *gin.Context) {
 		return
 	}
 
-	var req updateSessionTitleReq
+	var req updateSessionReq
 	if err := c.ShouldBindJSON(&req); err != nil {
 		fail(c, http.StatusBadRequest, 10001, "invalid json")
 		return
 	}
-
-	title := strings.TrimSpace(req.Title)
-	if title == "" {
-		fail(c, http.StatusBadRequest, 10002, "title required")
+	if req.Title == nil && req.Options == nil {
+		fail(c, http.StatusBadRequest, 10002, "title or options required")
 		return
 	}
-	if utf8.RuneCountInString(title) > 128 {
-		fail(c, http.StatusBadRequest, 10002, "title too long")
-		return
+
+	resp := gin.H{"session_id": sessionID}
+	var title string
+	if req.Title != nil {
+		title = strings.TrimSpace(*req.Title)
+		if title == "" {
+			fail(c, http.StatusBadRequest, 10002, "title required")
+			return
+		}
+		if utf8.RuneCountInString(title) > 128 {
+			fail(c, http.StatusBadRequest, 10002, "title too long")
+			return
+		}
+		resp["title"] = title
+	}
+	if req.Options != nil {
+		if err := req.Options.Validate(); err != nil {
+			fail(c, http.StatusBadRequest, 10002, err.Error())
+			return
+		}
+		resp["options"] = req.Options
 	}
 
-	if err := h.ChatSvc.UpdateSessionTitle(c.Request.Context(), uid, sessionID, title); err != nil {
-		if err == gorm.ErrRecordNotFound {
-			fail(c, http.StatusNotFound, 40401, "session not found")
+	if req.Title != nil {
+		if err := h.ChatSvc.UpdateSessionTitle(c.Request.Context(), uid, sessionID, title); err != nil {
+			if err == gorm.ErrRecordNotFound {
+				fail(c, http.StatusNotFound, 40401, "session not found")
+				return
+			}
+			fail(c, http.StatusInternalServerError, 50004, "failed to update session title")
+			return
+		}
+	}
+	if req.Options != nil {
+		if err := h.ChatSvc.UpdateSessionOptions(c.Request.Context(), uid, sessionID, *req.Options); err != nil {
+			if err == gorm.ErrRecordNotFound {
+				fail(c, http.StatusNotFound, 40401, "session not found")
+				return
+			}
+			fail(c, http.StatusInternalServerError, 50004, "failed to update session options")
 			return
 		}
-		fail(c, http.StatusInternalServerError, 50004, "failed to update session title")
-		return
 	}
 
-	ok(c, gin.H{"session_id": sessionID, "title": title})
+	ok(c, resp)
 }
 
 func (h *Handler) DeleteChatSession(c *gin.Context) {
@@ -183,9 +296,48 @@ func (h *Handler) DeleteChatSession(c *gin.Context) {
 	ok(c, gin.H{"session_id": sessionID, "deleted": true})
 }
 
+type toolResultReq struct {
+	ToolCallID string `json:"tool_call_id"`
+	Name       string `json:"name"`
+	Content    string `json:"content"`
+}
+
 type sendMessageReq struct {
-	SessionID string `json:"session_id" binding:"required"`
-	Message   string `json:"message" binding:"required"`
+	SessionID string `json:"session_id" form:"session_id" binding:"required"`
+	// Message may be empty when the turn only carries images or tool results.
+	Message     string          `json:"message" form:"message"`
+	Images      []imageReq      `json:"images" form:"-"`
+	Tools       []ai.Tool       `json:"tools" form:"-"`
+	ToolResults []toolResultReq `json:"tool_results" form:"-"`
+	// Options override the session's generation parameters for this reply.
+	Options *ai.GenerationOptions `json:"options" form:"-"`
+	// ResponseFormat asks for a JSON reply, returned parsed as well.
+	ResponseFormat *ai.ResponseFormat `json:"response_format" form:"-"`
+}
+
+// validResponseFormat reports a 400 for an unknown format or a schema that
+// doesn't compile.
+func validResponseFormat(c *gin.Context, f *ai.ResponseFormat) bool {
+	if f == nil {
+		return true
+	}
+	if err := f.Validate(); err != nil {
+		fail(c, http.StatusBadRequest, 10002, err.Error())
+		return false
+	}
+	return true
+}
+
+// validOptions reports a 400 for invalid per-message options.
+func validOptions(c *gin.Context, o *ai.GenerationOptions) bool {
+	if o == nil {
+		return true
+	}
+	if err := o.Validate(); err != nil {
+		fail(c, http.StatusBadRequest, 10002, err.Error())
+		return false
+	}
+	return true
 }
 
 func (h *Handler) SendChatMessage(c *gin.Context) {
@@ -196,26 +348,119 @@ func (h *Handler) SendChatMessage(c *gin.Context) {
 	}
 
 	var req sendMessageReq
-	if err := c.ShouldBindJSON(&req); err != nil {
+	uploads, err := bindMessageRequest(c, &req)
+	if err != nil {
 		fail(c, http.StatusBadRequest, 10001, "invalid json")
 		return
 	}
+	req.Images = append(req.Images, uploads...)
+	if req.Message == "" && len(req.Images) == 0 && len(req.ToolResults) == 0 {
+		fail(c, http.StatusBadRequest, 10002, "message, images or tool_results required")
+		return
+	}
+
+	if !validOptions(c, req.Options) || !validResponseFormat(c, req.ResponseFormat) {
+		return
+	}
+	images, okk := h.validImages(c, req.Images)
+	if !okk {
+		return
+	}
 
-	reply, msgID, err := h.ChatSvc.SendMessage(c.Request.Context(), uid, req.SessionID, req.Message)
+	for _, t := range req.Tools {
+		if strings.TrimSpace(t.Name) == "" {
+			fail(c, http.StatusBadRequest, 10002, "tool name required")
+			return
+		}
+	}
+	in := chat.SendInput{Content: req.Message, Images: images, Tools: req.Tools, Options: req.Options, ResponseFormat: req.ResponseFormat}
+	for _, tr := range req.ToolResults {
+		if strings.TrimSpace(tr.ToolCallID) == "" {
+			fail(c, http.StatusBadRequest, 10002, "tool_call_id required")
+			return
+		}
+		in.ToolResults = append(in.ToolResults, chat.ToolResult{ToolCallID: tr.ToolCallID, Name: tr.Name, Content: tr.Content})
+	}
+
+	msg, err := h.ChatSvc.Send(c.Request.Context(), uid, req.SessionID, in)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			fail(c, http.StatusNotFound, 40004, "session not found")
 			return
 		}
-		fail(c, http.StatusBadRequest, 40001, "failed to send message")
+		status, code, msg := sendFailure(err)
+		setRetryAfter(c, err)
+		fail(c, status, code, msg)
 		return
 	}
 
-	ok(c, gin.H{
+	resp := gin.H{
 		"session_id": req.SessionID,
-		"reply":      reply,
-		"message_id": msgID,
-	})
+		"reply":      msg.Content,
+		"reasoning":  msg.Reasoning,
+		"message_id": msg.ID,
+		"tool_calls": msg.ToolCalls,
+		"usage":      usagePayload(msg),
+	}
+	// the stored reply is already validated JSON, unless the model called tools
+	if req.ResponseFormat != nil && len(msg.ToolCalls) == 0 {
+		resp["parsed"] = json.RawMessage(msg.Content)
+	}
+	ok(c, resp)
+}
+
+// sendFailure maps a send error, usually from the provider, to an HTTP
+// status, a business code and a message that is safe to show to clients.
+func sendFailure(err error) (status int, code int, msg string) {
+	if errors.Is(err, chat.ErrAttachmentsDisabled) {
+		return http.StatusBadRequest, 10004, "image attachments are disabled"
+	}
+	if errors.Is(err, ai.ErrInvalidJSONOutput) {
+		return http.StatusUnprocessableEntity, 42202, "reply does not match response_format"
+	}
+	if errors.Is(err, ai.ErrBackendSaturated) {
+		return http.StatusTooManyRequests, 42902, "provider busy, retry later"
+	}
+	switch ai.ErrorKind(err) {
+	case ai.ErrContextTooLong:
+		return http.StatusBadRequest, 40010, "conversation is too long for the model"
+	case ai.ErrModelNotFound:
+		return http.StatusBadRequest, 40011, "model not found"
+	case ai.ErrContentFiltered:
+		return http.StatusUnprocessableEntity, 42201, "content filtered by provider"
+	case ai.ErrRateLimited:
+		return http.StatusTooManyRequests, 42901, "provider rate limited"
+	case ai.ErrAuthFailed:
+		return http.StatusBadGateway, 50201, "provider authentication failed"
+	case ai.ErrUpstreamUnavailable:
+		return http.StatusServiceUnavailable, 50301, "provider unavailable"
+	case ai.ErrTimeout:
+		return http.StatusGatewayTimeout, 50401, "provider timed out"
+	}
+	return http.StatusBadRequest, 40001, "failed to send message"
+}
+
+// setRetryAfter tells the client when to come back if err carries a hint.
+func setRetryAfter(c *gin.Context, err error) {
+	if d, okk := ai.RetryAfterHint(err); okk {
+		c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(d)))
+	}
+}
+
+func retryAfterSeconds(d time.Duration) int {
+	return max(1, int(math.Ceil(d.Seconds())))
+}
+
+// usagePayload describes which backend produced an assistant message and what it cost.
+func usagePayload(m *chat.Message) gin.H {
+	return gin.H{
+		"provider":          m.Provider,
+		"model":             m.Model,
+		"prompt_tokens":     m.PromptTokens,
+		"completion_tokens": m.CompletionTokens,
+		"total_tokens":      m.PromptTokens + m.CompletionTokens,
+		"latency_ms":        m.LatencyMs,
+	}
 }
 
 func (h *Handler) ListChatMessages(c *gin.Context) {
@@ -259,8 +504,10 @@ func (h *Handler) ListChatMessages(c *gin.Context) {
 
 func (h *Handler) SendChatMessageStream(c *gin.Context) {
 	type reqBody struct {
-		SessionID string `json:"session_id" binding:"required"`
-		Message   string `json:"message" binding:"required"`
+		SessionID string                `json:"session_id" form:"session_id" binding:"required"`
+		Message   string                `json:"message" form:"message"`
+		Images    []imageReq            `json:"images" form:"-"`
+		Options   *ai.GenerationOptions `json:"options" form:"-"`
 	}
 
 	uid, okk := userIDFromContext(c)
@@ -270,10 +517,23 @@ func (h *Handler) SendChatMessageStream(c *gin.Context) {
 	}
 
 	var req reqBody
-	if err := c.ShouldBindJSON(&req); err != nil {
+	uploads, err := bindMessageRequest(c, &req)
+	if err != nil {
 		fail(c, http.StatusBadRequest, 10001, "invalid json")
 		return
 	}
+	req.Images = append(req.Images, uploads...)
+	if req.Message == "" && len(req.Images) == 0 {
+		fail(c, http.StatusBadRequest, 10002, "message or images required")
+		return
+	}
+	if !validOptions(c, req.Options) {
+		return
+	}
+	images, okk := h.validImages(c, req.Images)
+	if !okk {
+		return
+	}
 
 	// idempotency key (optional)
 	idempoKey := strings.TrimSpace(c.GetHeader("Idempotency-Key"))
@@ -286,101 +546,86 @@ func (h *Handler) SendChatMessageStream(c *gin.Context) {
 		idempoKeyPtr = &idempoKey
 	}
 
-	// SSE headers
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
-	c.Header("X-Accel-Buffering", "no") // helpful if behind nginx
-
-	// avoid gin writing a JSON response later
-	c.Status(http.StatusOK)
-
 	ctx := c.Request.Context()
-	chunks, done, msgIDCh, errs := h.ChatSvc.SendMessageStream(ctx, uid, req.SessionID, req.Message, idempoKeyPtr)
-
-	// heartbeat ticker (keeps connections alive)
-	ticker := time.NewTicker(15 * time.Second)
-	defer ticker.Stop()
-
-	flusher, ok := c.Writer.(http.Flusher)
-	if !ok {
-		// can't stream
-		fmt.Fprintf(c.Writer, "event: error\ndata: flusher not supported\n\n")
-		return
-	}
-
-	writeJSON := func(event string, payload any) {
-		b, err := json.Marshal(payload)
-		if err != nil {
-			// last-resort: send a simple error that won't break SSE framing
-			fmt.Fprintf(c.Writer, "event: error\ndata: {\"message\":\"json marshal failed\"}\n\n")
-			flusher.Flush()
-			return
+	// the stream opens with the first event, or once the reply is slow to
+	// start; until then a saturated backend still gets a plain 429
+	sse := newSSE(c)
+	defer sse.close()
+	slow := time.AfterFunc(sseOpenDelay, func() { sse.open() })
+	defer slow.Stop()
+	writeJSON := sse.send
+
+	var finish string
+	emit := func(ch ai.Chunk) error {
+		if err := ctx.Err(); err != nil {
+			return err // client went away
 		}
-		if event != "" {
-			fmt.Fprintf(c.Writer, "event: %s\n", event)
+		if ch.Reasoning != "" {
+			writeJSON("reasoning", gin.H{
+				"type":  "reasoning",
+				"delta": ch.Reasoning,
+			})
 		}
-		fmt.Fprintf(c.Writer, "data: %s\n\n", string(b))
-		flusher.Flush()
-	}
-
-	for {
-		select {
-		case ch, ok := <-chunks:
-			if !ok {
-				chunks = nil
-				continue
-			}
+		if ch.Delta != "" {
 			writeJSON("chunk", gin.H{
 				"type":  "chunk",
-				"delta": ch,
-			})
-
-		case <-ticker.C:
-			writeJSON("ping", gin.H{
-				"type": "ping",
-				"ts":   time.Now().Unix(),
+				"delta": ch.Delta,
 			})
+		}
+		if ch.FinishReason != "" {
+			finish = ch.FinishReason
+		}
+		return nil
+	}
 
-		case err := <-errs:
-			if err == nil {
-				continue
-			}
-			if err == gorm.ErrRecordNotFound {
-				writeJSON("error", gin.H{
-					"type":    "error",
-					"message": "session not found",
-				})
-				return
-			}
+	msg, err := h.ChatSvc.SendMessageStream(ctx, uid, req.SessionID, chat.SendInput{Content: req.Message, Images: images, Options: req.Options}, idempoKeyPtr, emit)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
 			writeJSON("error", gin.H{
 				"type":    "error",
-				"message": err.Error(),
-			})
-			return
-
-		case <-done:
-			var mid uint64
-			select {
-			case mid = <-msgIDCh:
-			default:
-			}
-			writeJSON("done", gin.H{
-				"type":       "done",
-				"message_id": mid,
+				"message": "session not found",
 			})
 			return
-
-		case <-ctx.Done():
+		}
+		log.Printf("[SendChatMessageStream] uid=%d session_id=%s err=%v", uid, req.SessionID, err)
+		if errors.Is(err, ai.ErrBackendSaturated) && sse.takeOver() {
+			status, code, msg := sendFailure(err)
+			setRetryAfter(c, err)
+			fail(c, status, code, msg)
 			return
 		}
+		_, code, msg := sendFailure(err)
+		ev := gin.H{
+			"type":    "error",
+			"code":    code,
+			"message": msg,
+		}
+		if d, okk := ai.RetryAfterHint(err); okk {
+			ev["retry_after"] = retryAfterSeconds(d)
+		}
+		writeJSON("error", ev)
+		return
 	}
+
+	writeJSON("done", gin.H{
+		"type":          "done",
+		"message_id":    msg.ID,
+		"finish_reason": finish,
+		"usage":         usagePayload(msg),
+	})
 }
 
 func (h *Handler) SendChatMessageAsync(c *gin.Context) {
 	type reqBody struct {
-		SessionID string `json:"session_id" binding:"required"`
-		Message   string `json:"message" binding:"required"`
+		SessionID string                `json:"session_id" form:"session_id" binding:"required"`
+		Message   string                `json:"message" form:"message"`
+		Images    []imageReq            `json:"images" form:"-"`
+		Options   *ai.GenerationOptions `json:"options" form:"-"`
+
+		ResponseFormat *ai.ResponseFormat `json:"response_format" form:"-"`
 	}
 	var req reqBody
 
@@ -389,10 +634,23 @@ func (h *Handler) SendChatMessageAsync(c *gin.Context) {
 		fail(c, http.StatusUnauthorized, 40101, "unauthorized")
 		return
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
+	uploads, err := bindMessageRequest(c, &req)
+	if err != nil {
 		fail(c, http.StatusBadRequest, 10001, "invalid json")
 		return
 	}
+	req.Images = append(req.Images, uploads...)
+	if req.Message == "" && len(req.Images) == 0 {
+		fail(c, http.StatusBadRequest, 10002, "message or images required")
+		return
+	}
+	if !validOptions(c, req.Options) || !validResponseFormat(c, req.ResponseFormat) {
+		return
+	}
+	images, okk := h.validImages(c, req.Images)
+	if !okk {
+		return
+	}
 
 	// read idempotency key
 	idempoKey := strings.TrimSpace(c.GetHeader("Idempotency-Key"))
@@ -430,6 +688,8 @@ func (h *Handler) SendChatMessageAsync(c *gin.Context) {
 		UserID:         uid,
 		SessionID:      req.SessionID,
 		Prompt:         req.Message,
+		Options:        req.Options,
+		ResponseFormat: req.ResponseFormat,
 		IdempotencyKey: idempoKeyPtr,
 		Status:         chat.JobQueued,
 	}
@@ -457,7 +717,7 @@ func (h *Handler) SendChatMessageAsync(c *gin.Context) {
 	if created {
 		// Insert user message (idempotent when key is present)
 		if idempoKeyPtr == nil {
-			if err := h.ChatSvc.InsertUserMessage(c.Request.Context(), uid, req.SessionID, req.Message); err != nil {
+			if err := h.ChatSvc.InsertUserMessage(c.Request.Context(), uid, req.SessionID, req.Message, images); err != nil {
 				if err == gorm.ErrRecordNotFound {
 					fail(c, http.StatusNotFound, 40401, "session not found")
 					return
@@ -467,7 +727,7 @@ func (h *Handler) SendChatMessageAsync(c *gin.Context) {
 				return
 			}
 		} else {
-			if _, _, err := h.ChatSvc.InsertUserMessageOrGetExisting(c.Request.Context(), uid, req.SessionID, req.Message, idempoKeyPtr); err != nil {
+			if _, _, err := h.ChatSvc.InsertUserMessageOrGetExisting(c.Request.Context(), uid, req.SessionID, req.Message, images, idempoKeyPtr); err != nil {
 				log.Printf("[SendChatMessageAsync] InsertUserMessageOrGetExisting failed uid=%d session_id=%s key=%s err=%v", uid, req.SessionID, idempoKey, err)
 				fail(c, http.StatusInternalServerError, 50001, "internal error")
 				return
@@ -512,15 +772,28 @@ func (h *Handler) GetChatJob(c *gin.Context) {
 		return
 	}
 
-	ok(c, gin.H{
-		"job": gin.H{
-			"id":                j.ID,
-			"session_id":        j.SessionID,
-			"status":            j.Status,
-			"result_message_id": j.ResultMessageID,
-			"error":             j.Error,
-			"created_at":        j.CreatedAt,
-			"updated_at":        j.UpdatedAt,
-		},
-	})
+	job := gin.H{
+		"id":                j.ID,
+		"session_id":        j.SessionID,
+		"status":            j.Status,
+		"result_message_id": j.ResultMessageID,
+		"error":             j.Error,
+		"created_at":        j.CreatedAt,
+		"updated_at":        j.UpdatedAt,
+	}
+	if j.ResultMessageID != nil {
+		msg, err := h.ChatSvc.GetMessage(c.Request.Context(), uid, *j.ResultMessageID)
+		if err != nil && err != gorm.ErrRecordNotFound {
+			fail(c, http.StatusInternalServerError, 50001, "internal error")
+			return
+		}
+		if msg != nil {
+			job["usage"] = usagePayload(msg)
+			if j.ResponseFormat != nil && len(msg.ToolCalls) == 0 {
+				job["parsed"] = json.RawMessage(msg.Content)
+			}
+		}
+	}
+
+	ok(c, gin.H{"job": job})
 }
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/suPer8Hu/ai-platform/internal/ai"
+)
+
+const maxEmbedInputs = 256
+
+type embeddingsReq struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	// Input is a string or a list of strings.
+	Input json.RawMessage `json:"input" binding:"required"`
+}
+
+// inputs decodes Input, which may be a single string or a list.
+func (r embeddingsReq) inputs() ([]string, bool) {
+	var one string
+	if err := json.Unmarshal(r.Input, &one); err == nil {
+		return []string{one}, true
+	}
+	var many []string
+	if err := json.Unmarshal(r.Input, &many); err != nil {
+		return nil, false
+	}
+	return many, true
+}
+
+func (h *Handler) CreateEmbeddings(c *gin.Context) {
+	uid, okk := userIDFromContext(c)
+	if !okk {
+		fail(c, http.StatusUnauthorized, 40101, "unauthorized")
+		return
+	}
+
+	var req embeddingsReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, http.StatusBadRequest, 10001, "invalid json")
+		return
+	}
+	inputs, okk := req.inputs()
+	if !okk || len(inputs) == 0 {
+		fail(c, http.StatusBadRequest, 10002, "input must be a string or a list of strings")
+		return
+	}
+	if len(inputs) > maxEmbedInputs {
+		fail(c, http.StatusBadRequest, 10002, "too many inputs")
+		return
+	}
+	for _, in := range inputs {
+		if strings.TrimSpace(in) == "" {
+			fail(c, http.StatusBadRequest, 10002, "input must not be empty")
+			return
+		}
+	}
+
+	provider := strings.TrimSpace(req.Provider)
+	model := strings.TrimSpace(req.Model)
+	if provider == "" {
+		provider = h.Cfg.AIProvider
+	}
+	if model == "" {
+		model = h.Cfg.AIEmbedModel
+	}
+	p, err := h.Registry.Get(c.Request.Context(), provider, model)
+	if err != nil {
+		fail(c, http.StatusBadRequest, 10002, err.Error())
+		return
+	}
+	e, okk := p.(ai.Embedder)
+	if !okk {
+		fail(c, http.StatusBadRequest, 10002, "provider does not support embeddings")
+		return
+	}
+
+	res, err := e.Embed(c.Request.Context(), inputs)
+	if err != nil {
+		log.Printf("[CreateEmbeddings] uid=%d provider=%s model=%s err=%v", uid, provider, model, err)
+		status, code, msg := sendFailure(err)
+		if code == 40001 {
+			msg = "failed to create embeddings"
+		}
+		setRetryAfter(c, err)
+		fail(c, status, code, msg)
+		return
+	}
+
+	ok(c, gin.H{
+		"provider":   provider,
+		"model":      model,
+		"dimensions": res.Dimensions,
+		"embeddings": res.Vectors,
+		"usage":      gin.H{"prompt_tokens": res.Usage.PromptTokens},
+	})
+}
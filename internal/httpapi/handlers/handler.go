@@ -2,12 +2,13 @@ package handlers
 
 import (
 	"context"
-	"strings"
 
 	"github.com/suPer8Hu/ai-platform/internal/ai"
 	"github.com/suPer8Hu/ai-platform/internal/chat"
 	"github.com/suPer8Hu/ai-platform/internal/config"
 	"github.com/suPer8Hu/ai-platform/internal/email"
+	"github.com/suPer8Hu/ai-platform/internal/providers"
+	"github.com/suPer8Hu/ai-platform/internal/store/blobstore"
 	"github.com/suPer8Hu/ai-platform/internal/store/rabbitmq"
 	"github.com/suPer8Hu/ai-platform/internal/store/redisstore"
 	"gorm.io/gorm"
@@ -20,6 +21,11 @@ type Handler struct {
 	SMTPSetting email.SMTPConfig
 	ChatSvc     *chat.Service
 	Rabbit      *rabbitmq.Publisher
+	Registry    *ai.Registry
+	Breakers    *ai.Breakers
+	Limiters    *ai.Limiters
+	Providers   *providers.Set
+	Models      *ai.Catalog
 }
 
 func NewHandler(db *gorm.DB, cfg config.Config, r *redisstore.Store) *Handler {
@@ -35,34 +41,37 @@ func NewHandler(db *gorm.DB, cfg config.Config, r *redisstore.Store) *Handler {
 	// }
 
 	// Provider registry (route by session.Provider + session.Model)
-	reg := ai.NewRegistry()
-
-	// Register Ollama (default)
-	reg.Register("ollama", func(ctx context.Context, model string) (ai.Provider, error) {
-		m := strings.TrimSpace(model)
-		if m == "" {
-			m = cfg.OllamaModel
-		}
-		return ai.NewOllamaProvider(cfg.OllamaBaseURL, m), nil
-	})
+	providerSet, err := providers.New(cfg)
+	if err != nil {
+		panic(err)
+	}
+	reg := providerSet.Registry
 
-	// Register OpenRouter (OpenAI-compatible)
-	reg.Register("openrouter", func(ctx context.Context, model string) (ai.Provider, error) {
-		_ = ctx
-		m := strings.TrimSpace(model)
-		if m == "" {
-			m = cfg.OpenRouterModel
+	catalog := ai.NewCatalog(reg, cfg.AIModelsCacheTTL)
+	providerSet.OnReload(func(changed []string) {
+		for _, name := range changed {
+			catalog.Invalidate(name)
 		}
-		return ai.NewOpenRouterProvider(
-			cfg.OpenRouterBaseURL,
-			cfg.OpenRouterAPIKey,
-			m,
-			cfg.OpenRouterSiteURL,
-			cfg.OpenRouterAppName,
-		), nil
 	})
+	go providerSet.Watch(context.Background())
 
 	chatSvc := chat.NewService(repo, reg, cfg.ChatContextWindowSize)
+	chatSvc.SetTokenBudget(cfg.AIContextTokens, cfg.AIReplyReserveTokens)
+	chatSvc.SetCatalog(catalog)
+	// async jobs update summaries in the worker
+	chatSvc.SetBackgroundSummaries(true)
+	fallbacks, err := ai.ParseBackends(cfg.AIFallbackChain)
+	if err != nil {
+		panic(err)
+	}
+	chatSvc.SetFallbackChain(fallbacks)
+	if cfg.BlobDir != "" {
+		blobs, err := blobstore.NewLocal(cfg.BlobDir)
+		if err != nil {
+			panic(err)
+		}
+		chatSvc.SetBlobStore(blobs)
+	}
 
 	// rabbitmq
 	pub, err := rabbitmq.NewPublisher(cfg.RabbitURL, cfg.RabbitQueue)
@@ -74,7 +83,12 @@ func NewHandler(db *gorm.DB, cfg config.Config, r *redisstore.Store) *Handler {
 		User: cfg.SMTPUser,
 		Pass: cfg.SMTPPass,
 		From: cfg.SMTPFrom},
-		ChatSvc: chatSvc,
-		Rabbit:  pub,
+		ChatSvc:   chatSvc,
+		Rabbit:    pub,
+		Registry:  reg,
+		Breakers:  providerSet.Breakers,
+		Limiters:  providerSet.Limiters,
+		Providers: providerSet,
+		Models:    catalog,
 	}
 }
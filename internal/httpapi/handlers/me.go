@@ -150,6 +150,13 @@ func (h *Handler) DeleteMyAccount(c *gin.Context) {
 		return
 	}
 
+	// image blobs go once the messages referencing them are gone
+	atts, err := h.ChatSvc.UserAttachments(c.Request.Context(), userID)
+	if err != nil {
+		common.Fail(c, http.StatusInternalServerError, 20001, "db error")
+		return
+	}
+
 	if err := h.DB.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Where("user_id = ?", userID).Delete(&chat.Message{}).Error; err != nil {
 			return err
@@ -160,6 +167,9 @@ func (h *Handler) DeleteMyAccount(c *gin.Context) {
 		if err := tx.Where("user_id = ?", userID).Delete(&chat.Session{}).Error; err != nil {
 			return err
 		}
+		if err := tx.Where("user_id = ?", userID).Delete(&chat.Persona{}).Error; err != nil {
+			return err
+		}
 		if err := tx.Where("id = ?", userID).Delete(&models.User{}).Error; err != nil {
 			return err
 		}
@@ -168,6 +178,7 @@ func (h *Handler) DeleteMyAccount(c *gin.Context) {
 		common.Fail(c, http.StatusInternalServerError, 20001, "db error")
 		return
 	}
+	h.ChatSvc.DiscardAttachments(c.Request.Context(), atts)
 
 	common.OK(c, gin.H{"deleted": true})
 }
@@ -0,0 +1,12 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// ListModels returns the models discovered from every provider that can list
+// them. Providers whose listing failed are named in "unavailable".
+func (h *Handler) ListModels(c *gin.Context) {
+	models, unavailable := h.Models.Models(c.Request.Context())
+	ok(c, gin.H{"models": models, "unavailable": unavailable})
+}
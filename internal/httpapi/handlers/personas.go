@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/suPer8Hu/ai-platform/internal/ai"
+	"github.com/suPer8Hu/ai-platform/internal/chat"
+	"gorm.io/gorm"
+)
+
+const (
+	maxPersonaNameRunes  = 64
+	maxSystemPromptRunes = 16000
+)
+
+type personaReq struct {
+	Name         string                `json:"name"`
+	SystemPrompt string                `json:"system_prompt"`
+	Provider     string                `json:"provider"`
+	Model        string                `json:"model"`
+	Options      *ai.GenerationOptions `json:"options"`
+}
+
+// validSystemPrompt trims a system prompt and reports a 400 when it is too long.
+func validSystemPrompt(c *gin.Context, prompt string) (string, bool) {
+	prompt = strings.TrimSpace(prompt)
+	if utf8.RuneCountInString(prompt) > maxSystemPromptRunes {
+		fail(c, http.StatusBadRequest, 10002, "system_prompt too long")
+		return "", false
+	}
+	return prompt, true
+}
+
+// bindPersona parses and validates a persona body.
+func (h *Handler) bindPersona(c *gin.Context) (*chat.Persona, bool) {
+	var req personaReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, http.StatusBadRequest, 10001, "invalid json")
+		return nil, false
+	}
+
+	p := &chat.Persona{
+		Name:     strings.TrimSpace(req.Name),
+		Provider: strings.ToLower(strings.TrimSpace(req.Provider)),
+		Model:    strings.TrimSpace(req.Model),
+	}
+	if p.Name == "" {
+		fail(c, http.StatusBadRequest, 10002, "name required")
+		return nil, false
+	}
+	if utf8.RuneCountInString(p.Name) > maxPersonaNameRunes {
+		fail(c, http.StatusBadRequest, 10002, "name too long")
+		return nil, false
+	}
+	prompt, okk := validSystemPrompt(c, req.SystemPrompt)
+	if !okk {
+		return nil, false
+	}
+	if prompt == "" {
+		fail(c, http.StatusBadRequest, 10002, "system_prompt required")
+		return nil, false
+	}
+	p.SystemPrompt = prompt
+
+	switch {
+	case p.Provider != "":
+		model := p.Model
+		if model == "" {
+			model = h.defaultModel(p.Provider)
+		}
+		if !h.validBackend(c, p.Provider, model) {
+			return nil, false
+		}
+	case p.Model != "":
+		fail(c, http.StatusBadRequest, 10002, "provider required with model")
+		return nil, false
+	}
+	if req.Options != nil {
+		if err := req.Options.Validate(); err != nil {
+			fail(c, http.StatusBadRequest, 10002, err.Error())
+			return nil, false
+		}
+		p.Options = *req.Options
+	}
+	return p, true
+}
+
+func personaIDParam(c *gin.Context) (uint64, bool) {
+	id, err := strconv.ParseUint(c.Param("persona_id"), 10, 64)
+	if err != nil || id == 0 {
+		fail(c, http.StatusBadRequest, 10002, "invalid persona_id")
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *Handler) CreatePersona(c *gin.Context) {
+	uid, okk := userIDFromContext(c)
+	if !okk {
+		fail(c, http.StatusUnauthorized, 40101, "unauthorized")
+		return
+	}
+
+	p, okk := h.bindPersona(c)
+	if !okk {
+		return
+	}
+	if err := h.ChatSvc.CreatePersona(c.Request.Context(), uid, p); err != nil {
+		fail(c, http.StatusInternalServerError, 50008, "failed to create persona")
+		return
+	}
+	ok(c, p)
+}
+
+func (h *Handler) ListPersonas(c *gin.Context) {
+	uid, okk := userIDFromContext(c)
+	if !okk {
+		fail(c, http.StatusUnauthorized, 40101, "unauthorized")
+		return
+	}
+
+	ps, err := h.ChatSvc.ListPersonas(c.Request.Context(), uid)
+	if err != nil {
+		fail(c, http.StatusInternalServerError, 50009, "failed to list personas")
+		return
+	}
+	ok(c, gin.H{"personas": ps})
+}
+
+func (h *Handler) GetPersona(c *gin.Context) {
+	uid, okk := userIDFromContext(c)
+	if !okk {
+		fail(c, http.StatusUnauthorized, 40101, "unauthorized")
+		return
+	}
+	id, okk := personaIDParam(c)
+	if !okk {
+		return
+	}
+
+	p, err := h.ChatSvc.GetPersona(c.Request.Context(), uid, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fail(c, http.StatusNotFound, 40403, "persona not found")
+			return
+		}
+		fail(c, http.StatusInternalServerError, 50009, "failed to get persona")
+		return
+	}
+	ok(c, p)
+}
+
+// UpdatePersona replaces a persona. Existing sessions are not affected.
+func (h *Handler) UpdatePersona(c *gin.Context) {
+	uid, okk := userIDFromContext(c)
+	if !okk {
+		fail(c, http.StatusUnauthorized, 40101, "unauthorized")
+		return
+	}
+	id, okk := personaIDParam(c)
+	if !okk {
+		return
+	}
+
+	p, okk := h.bindPersona(c)
+	if !okk {
+		return
+	}
+	p.ID = id
+	if err := h.ChatSvc.UpdatePersona(c.Request.Context(), uid, p); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fail(c, http.StatusNotFound, 40403, "persona not found")
+			return
+		}
+		fail(c, http.StatusInternalServerError, 50008, "failed to update persona")
+		return
+	}
+	ok(c, gin.H{"id": id, "updated": true})
+}
+
+func (h *Handler) DeletePersona(c *gin.Context) {
+	uid, okk := userIDFromContext(c)
+	if !okk {
+		fail(c, http.StatusUnauthorized, 40101, "unauthorized")
+		return
+	}
+	id, okk := personaIDParam(c)
+	if !okk {
+		return
+	}
+
+	if err := h.ChatSvc.DeletePersona(c.Request.Context(), uid, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fail(c, http.StatusNotFound, 40403, "persona not found")
+			return
+		}
+		fail(c, http.StatusInternalServerError, 50008, "failed to delete persona")
+		return
+	}
+	ok(c, gin.H{"id": id, "deleted": true})
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sseOpenDelay is how long a lazily opened stream waits for its first event
+// before it opens anyway, so the heartbeat keeps slow replies alive.
+const sseOpenDelay = 2 * time.Second
+
+// sseStream writes server-sent events. Events are written by the handler and
+// by a heartbeat that keeps idle connections open; close stops the heartbeat
+// and must run before the handler returns, since the writer must not be used
+// after that.
+//
+// The headers go out with the first event or an explicit open, so until then
+// the handler may still answer with a plain HTTP response instead.
+type sseStream struct {
+	c       *gin.Context
+	flusher http.Flusher
+	mu      sync.Mutex
+	// opened is set once the headers are sent; done once the stream can no
+	// longer be opened
+	opened bool
+	done   bool
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newSSE(c *gin.Context) *sseStream {
+	return &sseStream{c: c, stop: make(chan struct{})}
+}
+
+// startSSE opens a stream right away. It returns nil when the response can't
+// be streamed.
+func startSSE(c *gin.Context) *sseStream {
+	s := newSSE(c)
+	if !s.open() {
+		return nil
+	}
+	return s
+}
+
+// open sends the event-stream headers and starts the heartbeat. It reports
+// whether the stream is open, which it can't be once taken over or closed.
+func (s *sseStream) open() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.openLocked()
+}
+
+func (s *sseStream) openLocked() bool {
+	if s.opened || s.done {
+		return s.opened
+	}
+	s.done = true
+
+	c := s.c
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // helpful if behind nginx
+
+	// avoid gin writing a JSON response later
+	c.Status(http.StatusOK)
+
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		// can't stream
+		fmt.Fprintf(c.Writer, "event: error\ndata: flusher not supported\n\n")
+		return false
+	}
+	s.flusher = flusher
+	s.opened = true
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(15 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.send("ping", gin.H{
+					"type": "ping",
+					"ts":   time.Now().Unix(),
+				})
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+	return true
+}
+
+// takeOver reports whether nothing was streamed yet. If so the stream stays
+// closed and the handler writes its own response.
+func (s *sseStream) takeOver() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.opened {
+		return false
+	}
+	s.done = true
+	return true
+}
+
+// send writes an event, opening the stream first if needed.
+func (s *sseStream) send(event string, payload any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.openLocked() {
+		return
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		// last-resort: send a simple error that won't break SSE framing
+		fmt.Fprintf(s.c.Writer, "event: error\ndata: {\"message\":\"json marshal failed\"}\n\n")
+		s.flusher.Flush()
+		return
+	}
+	if event != "" {
+		fmt.Fprintf(s.c.Writer, "event: %s\n", event)
+	}
+	fmt.Fprintf(s.c.Writer, "data: %s\n\n", string(b))
+	s.flusher.Flush()
+}
+
+func (s *sseStream) close() {
+	s.mu.Lock()
+	s.done = true
+	opened := s.opened
+	s.mu.Unlock()
+	if opened {
+		close(s.stop)
+		s.wg.Wait()
+	}
+}
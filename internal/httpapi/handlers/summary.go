@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/suPer8Hu/ai-platform/internal/ai"
+	"github.com/suPer8Hu/ai-platform/internal/chat"
+	"gorm.io/gorm"
+)
+
+// summaryPayload describes the rolling summary of the turns that fell out of
+// a session's context window.
+func summaryPayload(s *chat.Session) gin.H {
+	return gin.H{
+		"session_id":            s.SessionID,
+		"summary":               s.Summary,
+		"summarized_through_id": s.SummaryThroughID,
+		"updated_at":            s.SummaryUpdatedAt,
+	}
+}
+
+func (h *Handler) GetChatSummary(c *gin.Context) {
+	uid, okk := userIDFromContext(c)
+	if !okk {
+		fail(c, http.StatusUnauthorized, 40101, "unauthorized")
+		return
+	}
+
+	sess, err := h.ChatSvc.GetSummary(c.Request.Context(), uid, c.Param("session_id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fail(c, http.StatusNotFound, 40401, "session not found")
+			return
+		}
+		fail(c, http.StatusInternalServerError, 50006, "failed to get summary")
+		return
+	}
+	ok(c, summaryPayload(sess))
+}
+
+// RegenerateChatSummary rebuilds the summary from scratch, synchronously.
+func (h *Handler) RegenerateChatSummary(c *gin.Context) {
+	uid, okk := userIDFromContext(c)
+	if !okk {
+		fail(c, http.StatusUnauthorized, 40101, "unauthorized")
+		return
+	}
+
+	sess, err := h.ChatSvc.RegenerateSummary(c.Request.Context(), uid, c.Param("session_id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fail(c, http.StatusNotFound, 40401, "session not found")
+			return
+		}
+		if ai.ErrorKind(err) != nil {
+			status, code, msg := sendFailure(err)
+			setRetryAfter(c, err)
+			fail(c, status, code, msg)
+			return
+		}
+		fail(c, http.StatusInternalServerError, 50007, "failed to regenerate summary")
+		return
+	}
+	ok(c, summaryPayload(sess))
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/suPer8Hu/ai-platform/internal/common"
+)
+
+// AdminRequired only lets the given users through. It must run after AuthRequired.
+func AdminRequired(adminUserIDs []uint64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, _ := c.Get(UserIDKey)
+		uid, ok := v.(uint64)
+		if !ok || !slices.Contains(adminUserIDs, uid) {
+			common.Fail(c, http.StatusForbidden, 40300, "admin only")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -66,13 +66,32 @@ func NewRouter(db *gorm.DB, cfg config.Config, rds *redisstore.Store) *gin.Engin
 	// Chat (JWT required)
 	authGroup.POST("/chat/sessions", h.CreateChatSession)
 	authGroup.GET("/chat/sessions", h.ListChatSessions)
-	authGroup.PATCH("/chat/sessions/:session_id", h.UpdateChatSessionTitle)
+	authGroup.PATCH("/chat/sessions/:session_id", h.UpdateChatSession)
 	authGroup.DELETE("/chat/sessions/:session_id", h.DeleteChatSession)
 	authGroup.POST("/chat/messages", h.SendChatMessage)
 	authGroup.POST("/chat/messages/stream", h.SendChatMessageStream)
 	authGroup.POST("/chat/messages/async", h.SendChatMessageAsync)
 	authGroup.GET("/chat/sessions/:session_id/messages", h.ListChatMessages)
+	authGroup.GET("/chat/sessions/:session_id/summary", h.GetChatSummary)
+	authGroup.POST("/chat/sessions/:session_id/summary", h.RegenerateChatSummary)
 	authGroup.GET("/chat/jobs/:job_id", h.GetChatJob)
+	authGroup.POST("/personas", h.CreatePersona)
+	authGroup.GET("/personas", h.ListPersonas)
+	authGroup.GET("/personas/:persona_id", h.GetPersona)
+	authGroup.PUT("/personas/:persona_id", h.UpdatePersona)
+	authGroup.DELETE("/personas/:persona_id", h.DeletePersona)
+	authGroup.GET("/models", h.ListModels)
+	authGroup.POST("/embeddings", h.CreateEmbeddings)
+
+	// Admin (JWT + ADMIN_USER_IDS)
+	adminGroup := authGroup.Group("/admin")
+	adminGroup.Use(middleware.AdminRequired(cfg.AdminUserIDs))
+	adminGroup.GET("/providers/health", h.ProviderHealth)
+	adminGroup.GET("/ollama/models", h.ListOllamaModels)
+	adminGroup.GET("/ollama/models/show", h.ShowOllamaModel)
+	adminGroup.POST("/ollama/models/pull", h.PullOllamaModel)
+	adminGroup.POST("/ollama/models/preload", h.PreloadOllamaModel)
+	adminGroup.DELETE("/ollama/models", h.DeleteOllamaModel)
 
 	return r
 }
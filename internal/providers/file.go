@@ -0,0 +1,237 @@
+// Package providers builds the ai.Registry shared by the API and the worker,
+// from a providers file or, without one, from the env config, and reloads it
+// when the file changes.
+package providers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/suPer8Hu/ai-platform/internal/config"
+)
+
+// Backend types.
+const (
+	TypeOllama     = "ollama"
+	TypeOpenAI     = "openai"
+	TypeOpenRouter = "openrouter"
+	TypeAnthropic  = "anthropic"
+	TypeGemini     = "gemini"
+)
+
+// defaultModels are used when a backend names no model.
+var defaultModels = map[string]string{
+	TypeOllama:     "llama3:latest",
+	TypeOpenRouter: "openrouter/auto",
+	TypeAnthropic:  "claude-sonnet-4-5",
+	TypeGemini:     "gemini-2.5-flash",
+}
+
+// File is the providers file, in YAML or JSON:
+//
+//	backends:
+//	  - name: ollama
+//	    base_urls: [http://gpu1:11434, http://gpu2:11434]
+//	    model: llama3:latest
+//	  - name: openrouter
+//	    api_key_env: OPENROUTER_API_KEY
+//	    models: [openrouter/auto, openai/gpt-4o-mini]
+//	    limits: {max_concurrent: 8, queue_timeout: 10s}
+//	  - name: vllm
+//	    type: openai
+//	    base_url: http://vllm:8000/v1
+//	    api_key_file: /run/secrets/vllm_key
+type File struct {
+	Backends []Backend `yaml:"backends"`
+}
+
+// Backend declares one named provider backend.
+type Backend struct {
+	// Name is what sessions and fallback chains call the backend.
+	Name string `yaml:"name"`
+	// Type is one of the Type constants; it defaults to Name.
+	Type    string `yaml:"type"`
+	BaseURL string `yaml:"base_url"`
+	// BaseURLs of several Ollama nodes make a load-balanced pool.
+	BaseURLs []string `yaml:"base_urls"`
+	// The API key is never written in the file: it is read from the
+	// environment variable APIKeyEnv or the file APIKeyFile.
+	APIKeyEnv  string `yaml:"api_key_env"`
+	APIKeyFile string `yaml:"api_key_file"`
+	// Model is the default model; it defaults to the first of Models.
+	Model string `yaml:"model"`
+	// Models is the allowlist of models; empty allows any.
+	Models []string `yaml:"models"`
+	Limits Limits   `yaml:"limits"`
+
+	// MaxTokens is the default reply budget of anthropic backends.
+	MaxTokens int `yaml:"max_tokens"`
+	// SiteURL and AppName identify the app to openrouter.
+	SiteURL string `yaml:"site_url"`
+	AppName string `yaml:"app_name"`
+
+	apiKey string
+}
+
+// Limits bound the concurrent requests to each node of a backend; zero
+// fields take the AI_MAX_CONCURRENT, AI_MAX_QUEUE and AI_QUEUE_TIMEOUT
+// defaults.
+type Limits struct {
+	MaxConcurrent int           `yaml:"max_concurrent"`
+	MaxQueue      int           `yaml:"max_queue"`
+	QueueTimeout  time.Duration `yaml:"queue_timeout"`
+}
+
+// ReadFile reads and validates a providers file, resolving API keys.
+func ReadFile(path string) (File, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return File{}, err
+	}
+	var f File
+	if err := yaml.UnmarshalWithOptions(b, &f, yaml.DisallowUnknownField()); err != nil {
+		return File{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := f.resolve(); err != nil {
+		return File{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+func (f *File) resolve() error {
+	seen := make(map[string]bool)
+	for i := range f.Backends {
+		b := &f.Backends[i]
+		if err := b.resolve(); err != nil {
+			if b.Name == "" {
+				return fmt.Errorf("backend %d: %w", i+1, err)
+			}
+			return fmt.Errorf("backend %s: %w", b.Name, err)
+		}
+		if seen[b.Name] {
+			return fmt.Errorf("backend %s: declared twice", b.Name)
+		}
+		seen[b.Name] = true
+	}
+	return nil
+}
+
+func (b *Backend) resolve() error {
+	b.Name = strings.ToLower(strings.TrimSpace(b.Name))
+	if b.Name == "" {
+		return fmt.Errorf("name required")
+	}
+	if b.Name == "replay" {
+		return fmt.Errorf("name %q is reserved", b.Name)
+	}
+	b.Type = strings.ToLower(strings.TrimSpace(b.Type))
+	if b.Type == "" {
+		b.Type = b.Name
+	}
+	switch b.Type {
+	case TypeOllama, TypeOpenAI, TypeOpenRouter, TypeAnthropic, TypeGemini:
+	default:
+		return fmt.Errorf("unknown type %q", b.Type)
+	}
+
+	if b.BaseURL != "" && len(b.BaseURLs) > 0 {
+		return fmt.Errorf("set base_url or base_urls, not both")
+	}
+	if len(b.BaseURLs) > 0 {
+		if b.Type != TypeOllama {
+			return fmt.Errorf("base_urls is only supported by ollama")
+		}
+		if len(b.BaseURLs) == 1 {
+			b.BaseURL, b.BaseURLs = b.BaseURLs[0], nil
+		}
+	}
+	if b.Type == TypeOllama && b.BaseURL == "" && len(b.BaseURLs) == 0 {
+		b.BaseURL = "http://localhost:11434"
+	}
+
+	switch {
+	case b.APIKeyEnv != "" && b.APIKeyFile != "":
+		return fmt.Errorf("set api_key_env or api_key_file, not both")
+	case b.APIKeyEnv != "":
+		b.apiKey = os.Getenv(b.APIKeyEnv)
+		if b.apiKey == "" {
+			return fmt.Errorf("api_key_env %s is not set", b.APIKeyEnv)
+		}
+	case b.APIKeyFile != "":
+		key, err := os.ReadFile(b.APIKeyFile)
+		if err != nil {
+			return fmt.Errorf("api_key_file: %w", err)
+		}
+		b.apiKey = strings.TrimSpace(string(key))
+	}
+
+	b.Model = strings.TrimSpace(b.Model)
+	if b.Model == "" && len(b.Models) > 0 {
+		b.Model = b.Models[0]
+	}
+	if b.Model == "" {
+		b.Model = defaultModels[b.Type]
+	}
+	if len(b.Models) > 0 && b.Model != "" && !contains(b.Models, b.Model) {
+		return fmt.Errorf("model %s is not in models", b.Model)
+	}
+
+	if b.Limits.MaxConcurrent < 0 || b.Limits.MaxQueue < 0 || b.Limits.QueueTimeout < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// nodes returns the backend's base URLs.
+func (b Backend) nodes() []string {
+	if len(b.BaseURLs) > 0 {
+		return b.BaseURLs
+	}
+	return []string{b.BaseURL}
+}
+
+// digest identifies the backend's settings, including the resolved key, so
+// a reload can tell which backends changed.
+func (b Backend) digest() string {
+	raw, _ := json.Marshal(struct {
+		Backend
+		APIKey string
+	}{b, b.apiKey})
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:8])
+}
+
+// FromEnv declares the backends of the per-provider env vars, as used when
+// there is no providers file.
+func FromEnv(cfg config.Config) (File, error) {
+	f := File{Backends: []Backend{
+		{Name: TypeOllama, BaseURLs: cfg.OllamaBaseURLs, Model: cfg.OllamaModel},
+		{Name: TypeOpenRouter, BaseURL: cfg.OpenRouterBaseURL, Model: cfg.OpenRouterModel,
+			SiteURL: cfg.OpenRouterSiteURL, AppName: cfg.OpenRouterAppName, apiKey: cfg.OpenRouterAPIKey},
+		{Name: TypeAnthropic, BaseURL: cfg.AnthropicBaseURL, Model: cfg.AnthropicModel,
+			MaxTokens: cfg.AnthropicMaxTokens, apiKey: cfg.AnthropicAPIKey},
+		{Name: TypeGemini, BaseURL: cfg.GeminiBaseURL, Model: cfg.GeminiModel, apiKey: cfg.GeminiAPIKey},
+	}}
+	for _, b := range cfg.OpenAIBackends {
+		f.Backends = append(f.Backends, Backend{Name: b.Name, Type: TypeOpenAI, BaseURL: b.BaseURL, Model: b.Model, apiKey: b.APIKey})
+	}
+	if err := f.resolve(); err != nil {
+		return File{}, err
+	}
+	return f, nil
+}
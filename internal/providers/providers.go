@@ -0,0 +1,301 @@
+package providers
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/suPer8Hu/ai-platform/internal/ai"
+	"github.com/suPer8Hu/ai-platform/internal/config"
+)
+
+// watchInterval is how often Watch checks the providers file for changes.
+const watchInterval = 5 * time.Second
+
+// Set is the provider wiring of a process: the registry of the declared
+// backends, behind shared breakers, limiters and retries.
+type Set struct {
+	Registry *ai.Registry
+	Breakers *ai.Breakers
+	Limiters *ai.Limiters
+
+	cfg config.Config
+
+	mu       sync.Mutex
+	backends map[string]*backend
+	onReload []func(changed []string)
+}
+
+type backend struct {
+	spec   Backend
+	digest string
+	// pool spreads an ollama backend with several base URLs
+	pool *ai.OllamaPool
+}
+
+// New builds the registry from cfg.AIProvidersFile, or from the env config
+// when no file is set. The replay provider is always registered.
+func New(cfg config.Config) (*Set, error) {
+	s := &Set{
+		Registry: ai.NewRegistry(),
+		Breakers: ai.NewBreakers(ai.BreakerConfig{FailureThreshold: cfg.AIBreakerFailures, Cooldown: cfg.AIBreakerCooldown}),
+		Limiters: ai.NewLimiters(ai.LimiterConfig{MaxConcurrent: cfg.AIMaxConcurrent, MaxQueue: cfg.AIMaxQueue, QueueTimeout: cfg.AIQueueTimeout}),
+		cfg:      cfg,
+		backends: make(map[string]*backend),
+	}
+	s.Registry.UseBreakers(s.Breakers)
+	s.Registry.UseLimiters(s.Limiters)
+	s.Registry.UseRetry(s.retry())
+
+	f, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	s.apply(f)
+
+	// record/replay (AI_PROVIDER=replay runs offline)
+	reg := s.Registry
+	reg.Register("replay", func(ctx context.Context, model string) (ai.Provider, error) {
+		var upstream ai.Provider
+		if cfg.AIReplayMode == ai.ReplayModeRecord {
+			p, err := reg.Get(ctx, cfg.AIReplayUpstream, model)
+			if err != nil {
+				return nil, err
+			}
+			upstream = p
+		}
+		return ai.NewReplayProvider(cfg.AIReplayMode, cfg.AIReplayDir, strings.TrimSpace(model), upstream)
+	})
+	return s, nil
+}
+
+func (s *Set) retry() ai.RetryConfig {
+	return ai.RetryConfig{MaxAttempts: s.cfg.AIRetryMaxAttempts, BaseDelay: s.cfg.AIRetryBaseDelay, MaxDelay: s.cfg.AIRetryMaxDelay}
+}
+
+func (s *Set) load() (File, error) {
+	if s.cfg.AIProvidersFile == "" {
+		return FromEnv(s.cfg)
+	}
+	return ReadFile(s.cfg.AIProvidersFile)
+}
+
+// OnReload registers fn to run after a reload with the names of the
+// backends that were added, changed or removed.
+func (s *Set) OnReload(fn func(changed []string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onReload = append(s.onReload, fn)
+}
+
+// Reload reads the providers file again. Backends whose settings didn't
+// change are kept as they are, with their pools and limiters; when the file
+// is invalid the current backends stay.
+func (s *Set) Reload() error {
+	f, err := s.load()
+	if err != nil {
+		return err
+	}
+	changed := s.apply(f)
+	if len(changed) == 0 {
+		return nil
+	}
+	log.Printf("providers: reloaded, changed=%v", changed)
+	s.mu.Lock()
+	hooks := append([]func([]string){}, s.onReload...)
+	s.mu.Unlock()
+	for _, fn := range hooks {
+		fn(changed)
+	}
+	return nil
+}
+
+// apply registers the backends of f in place of the current ones and
+// returns the names that changed.
+func (s *Set) apply(f File) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changed []string
+	next := make(map[string]*backend, len(f.Backends))
+	for _, spec := range f.Backends {
+		d := spec.digest()
+		if cur, ok := s.backends[spec.Name]; ok && cur.digest == d {
+			next[spec.Name] = cur
+			continue
+		}
+		b := &backend{spec: spec, digest: d}
+		if spec.Type == TypeOllama && len(spec.BaseURLs) > 1 {
+			b.pool = ai.NewOllamaPool(spec.BaseURLs, s.cfg.AIBreakerFailures, s.cfg.AIBreakerCooldown)
+		}
+		s.setLimits(b)
+		if b.pool != nil {
+			retry := s.retry()
+			b.pool.UseTransports(s.Breakers, s.Limiters, &retry)
+		}
+		s.Registry.AllowModels(spec.Name, spec.Models)
+		s.Registry.RegisterConfig(spec.Name, d, b.factory)
+		next[spec.Name] = b
+		changed = append(changed, spec.Name)
+	}
+	for name := range s.backends {
+		if _, ok := next[name]; !ok {
+			s.Registry.Unregister(name)
+			changed = append(changed, name)
+		}
+	}
+	s.backends = next
+	sort.Strings(changed)
+	return changed
+}
+
+// setLimits applies the backend's limits, or the defaults, to each node.
+func (s *Set) setLimits(b *backend) {
+	cfg := s.Limiters.Default()
+	if l := b.spec.Limits; l.MaxConcurrent > 0 {
+		cfg.MaxConcurrent = l.MaxConcurrent
+	}
+	if l := b.spec.Limits; l.MaxQueue > 0 {
+		cfg.MaxQueue = l.MaxQueue
+	}
+	if l := b.spec.Limits; l.QueueTimeout > 0 {
+		cfg.QueueTimeout = l.QueueTimeout
+	}
+	if b.pool != nil {
+		for _, n := range b.pool.Nodes() {
+			s.Limiters.SetLimit(ai.BackendKey(ai.NewOllamaProvider(n, "")), cfg)
+		}
+		return
+	}
+	s.Limiters.SetLimit(ai.BackendKey(b.provider("")), cfg)
+}
+
+func (b *backend) factory(ctx context.Context, model string) (ai.Provider, error) {
+	m := strings.TrimSpace(model)
+	if m == "" {
+		m = b.spec.Model
+	}
+	return b.provider(m), nil
+}
+
+func (b *backend) provider(model string) ai.Provider {
+	spec := b.spec
+	switch spec.Type {
+	case TypeOllama:
+		if b.pool != nil {
+			return b.pool.Provider(model)
+		}
+		return ai.NewOllamaProvider(spec.BaseURL, model)
+	case TypeOpenRouter:
+		return ai.NewOpenRouterProvider(spec.BaseURL, spec.apiKey, model, spec.SiteURL, spec.AppName)
+	case TypeAnthropic:
+		return ai.NewAnthropicProvider(spec.BaseURL, spec.apiKey, model, spec.MaxTokens)
+	case TypeGemini:
+		return ai.NewGeminiProvider(spec.BaseURL, spec.apiKey, model)
+	}
+	return ai.NewOpenAIProvider(spec.Name, spec.BaseURL, spec.apiKey, model)
+}
+
+// DefaultModel returns the default model of the backend called name, or ""
+// when unknown.
+func (s *Set) DefaultModel(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = TypeOllama
+	}
+	if name == "replay" {
+		return s.DefaultModel(s.cfg.AIReplayUpstream)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b, ok := s.backends[name]; ok {
+		return b.spec.Model
+	}
+	return ""
+}
+
+// OllamaBackends returns the names of the ollama backends, sorted.
+func (s *Set) OllamaBackends() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ollamaBackendsLocked()
+}
+
+func (s *Set) ollamaBackendsLocked() []string {
+	names := make([]string, 0, len(s.backends))
+	for name, b := range s.backends {
+		if b.spec.Type == TypeOllama {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OllamaNodes returns the base URLs of every ollama backend.
+func (s *Set) OllamaNodes() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := s.ollamaBackendsLocked()
+
+	var out []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		for _, n := range s.backends[name].spec.nodes() {
+			if !seen[n] {
+				seen[n] = true
+				out = append(out, n)
+			}
+		}
+	}
+	return out
+}
+
+// Watch reloads the providers file on SIGHUP and whenever it changes, until
+// ctx is done. The file is polled, since editors and config maps replace it
+// rather than write to it. Without a file there is nothing to watch.
+func (s *Set) Watch(ctx context.Context) {
+	path := s.cfg.AIProvidersFile
+	if path == "" {
+		return
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	last := fileStamp(path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-ticker.C:
+			st := fileStamp(path)
+			if st == last {
+				continue
+			}
+			last = st
+		}
+		if err := s.Reload(); err != nil {
+			log.Printf("providers: reload failed, keeping the current backends: %v", err)
+		}
+	}
+}
+
+// fileStamp changes whenever the file is written or replaced.
+func fileStamp(path string) string {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fi.ModTime().String() + "|" + strconv.FormatInt(fi.Size(), 10)
+}
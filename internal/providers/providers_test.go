@@ -0,0 +1,165 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/suPer8Hu/ai-platform/internal/ai"
+	"github.com/suPer8Hu/ai-platform/internal/config"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func TestReadFile_YAMLAndJSON(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TEST_ROUTER_KEY", "sk-test")
+	writeFile(t, filepath.Join(dir, "key"), "file-key\n")
+
+	yml := filepath.Join(dir, "providers.yaml")
+	writeFile(t, yml, `
+backends:
+  - name: ollama
+    base_urls: [http://a:11434, http://b:11434]
+  - name: router
+    type: openrouter
+    api_key_env: TEST_ROUTER_KEY
+    models: [openai/gpt-4o-mini, openrouter/auto]
+    limits: {max_concurrent: 2, queue_timeout: 5s}
+  - name: vllm
+    type: openai
+    base_url: http://vllm:8000/v1
+    api_key_file: `+filepath.Join(dir, "key")+`
+`)
+	f, err := ReadFile(yml)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	ollama, router, vllm := f.Backends[0], f.Backends[1], f.Backends[2]
+	if ollama.Type != TypeOllama || ollama.Model != "llama3:latest" || len(ollama.BaseURLs) != 2 {
+		t.Fatalf("unexpected ollama backend %+v", ollama)
+	}
+	if router.apiKey != "sk-test" || router.Model != "openai/gpt-4o-mini" || router.Limits.QueueTimeout != 5*time.Second {
+		t.Fatalf("unexpected router backend %+v", router)
+	}
+	if vllm.apiKey != "file-key" {
+		t.Fatalf("expected the key file to be read, got %q", vllm.apiKey)
+	}
+
+	js := filepath.Join(dir, "providers.json")
+	writeFile(t, js, `{"backends": [{"name": "gemini", "api_key_env": "TEST_ROUTER_KEY"}]}`)
+	if f, err := ReadFile(js); err != nil || f.Backends[0].Model != "gemini-2.5-flash" {
+		t.Fatalf("unexpected json result %+v, %v", f, err)
+	}
+
+	for _, bad := range []string{
+		`backends: [{name: x, type: nope}]`,
+		`backends: [{name: ollama}, {name: ollama}]`,
+		`backends: [{name: ollama, model: a, models: [b]}]`,
+		`backends: [{name: ollama, api_key: inline}]`,
+		`backends: [{name: openrouter, api_key_env: TEST_UNSET_KEY}]`,
+	} {
+		writeFile(t, yml, bad)
+		if _, err := ReadFile(yml); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestSet_ReloadKeepsUnchangedBackends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "providers.yaml")
+	writeFile(t, path, `
+backends:
+  - name: ollama
+    base_url: http://a:11434
+  - name: vllm
+    type: openai
+    base_url: http://vllm:8000/v1
+    models: [qwen3]
+`)
+	s, err := New(config.Config{AIProvidersFile: path})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	var reloaded []string
+	s.OnReload(func(changed []string) { reloaded = changed })
+	ctx := context.Background()
+
+	if _, err := s.Registry.Get(ctx, "ollama", ""); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	ollama := s.backends["ollama"]
+	if _, err := s.Registry.Get(ctx, "vllm", "llama3"); !errors.Is(err, ai.ErrUnknownModel) {
+		t.Fatalf("expected the allowlist to reject llama3, got %v", err)
+	}
+
+	// an invalid file keeps the current backends
+	writeFile(t, path, `backends: [{name: ollama, type: nope}]`)
+	if err := s.Reload(); err == nil {
+		t.Fatalf("expected the invalid file to fail")
+	}
+
+	writeFile(t, path, `
+backends:
+  - name: ollama
+    base_url: http://a:11434
+  - name: gemini
+    api_key_file: /dev/null
+`)
+	if err := s.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if len(reloaded) != 2 || reloaded[0] != "gemini" || reloaded[1] != "vllm" {
+		t.Fatalf("unexpected changed backends %v", reloaded)
+	}
+	if _, err := s.Registry.Get(ctx, "vllm", "qwen3"); err == nil {
+		t.Fatalf("expected vllm to be gone")
+	}
+	if s.DefaultModel("gemini") != "gemini-2.5-flash" {
+		t.Fatalf("unexpected gemini default %q", s.DefaultModel("gemini"))
+	}
+	if s.backends["ollama"] != ollama {
+		t.Fatalf("expected the unchanged ollama backend to be kept")
+	}
+}
+
+func TestSet_OllamaBackendsByType(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "providers.yaml")
+	writeFile(t, path, `
+backends:
+  - name: gpu
+    type: ollama
+    base_urls: [http://a:11434, http://b:11434]
+  - name: cpu
+    type: ollama
+    base_url: http://b:11434
+  - name: gemini
+    api_key_file: /dev/null
+`)
+	s, err := New(config.Config{AIProvidersFile: path})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if got := s.OllamaBackends(); len(got) != 2 || got[0] != "cpu" || got[1] != "gpu" {
+		t.Fatalf("unexpected ollama backends %v", got)
+	}
+	if got := s.OllamaNodes(); len(got) != 2 || got[0] != "http://b:11434" || got[1] != "http://a:11434" {
+		t.Fatalf("unexpected ollama nodes %v", got)
+	}
+
+	writeFile(t, path, `backends: [{name: gemini, api_key_file: /dev/null}]`)
+	if err := s.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if len(s.OllamaBackends()) != 0 || len(s.OllamaNodes()) != 0 {
+		t.Fatalf("expected no ollama backends, got %v", s.OllamaBackends())
+	}
+}
@@ -0,0 +1,89 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/suPer8Hu/ai-platform/internal/common"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps binary attachments (e.g. chat images) outside the database.
+type Store interface {
+	Put(ctx context.Context, data []byte) (key string, err error)
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Local stores blobs as files under Dir, sharded by the first two key characters.
+type Local struct {
+	Dir string
+}
+
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("blobstore: %w", err)
+	}
+	return &Local{Dir: dir}, nil
+}
+
+var keyPattern = regexp.MustCompile(`^[0-9A-Z]{26}$`)
+
+func (l *Local) path(key string) (string, error) {
+	if !keyPattern.MatchString(key) {
+		return "", fmt.Errorf("blobstore: invalid key %q", key)
+	}
+	return filepath.Join(l.Dir, key[:2], key), nil
+}
+
+func (l *Local) Put(ctx context.Context, data []byte) (string, error) {
+	_ = ctx
+	key, err := common.NewULID()
+	if err != nil {
+		return "", err
+	}
+	p, _ := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+		return "", err
+	}
+	// write then rename so readers never see a partial file
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o640); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	return key, nil
+}
+
+func (l *Local) Get(ctx context.Context, key string) ([]byte, error) {
+	_ = ctx
+	p, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return b, err
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	_ = ctx
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}